@@ -0,0 +1,342 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errNotLoaded is returned to the waiters of a key which the batch loader did not return.
+var errNotLoaded = errors.New("object not returned by loader")
+
+func (c *cache) GetObjects(ctx context.Context, keys []string, objs any, ttl time.Duration, f func(missingKeys []string) (map[string]any, error), opts ...Option) error {
+	return c.GetObjectsCtx(ctx, keys, objs, ttl, func(_ context.Context, missingKeys []string) (map[string]any, error) {
+		return f(missingKeys)
+	}, opts...)
+}
+
+func (c *cache) GetObjectsCtx(ctx context.Context, keys []string, objs any, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]any, error), opts ...Option) error {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
+	opt := newOptions(opts...)
+
+	dst := reflect.ValueOf(objs)
+	if dst.Kind() != reflect.Map || dst.IsNil() || dst.Type().Key().Kind() != reflect.String {
+		return errors.WithStack(ErrIllegalObjs)
+	}
+
+	c.logger.Debug("[seaguest/cache] GetObjects called", "keys", keys, "ttl", ttl)
+	defer c.logger.Debug("[seaguest/cache] GetObjects completed", "keys", keys, "ttl", ttl)
+
+	// is disabled, call loader function
+	if c.options.Disabled {
+		results, err := f(ctx, keys)
+		if err != nil {
+			return err
+		}
+		return c.copyObjects(ctx, results, dst)
+	}
+
+	type result struct {
+		objs map[string]any
+		err  error
+	}
+
+	// objects are collected in a new map and copied to objs only if not timed out, objs must never be written concurrently.
+	done := make(chan result, 1)
+	c.inflight.Add(1)
+	go func() {
+		defer c.inflight.Add(-1)
+		results, err := c.getObjects(ctx, keys, dst.Type().Elem(), ttl, f, opt)
+		done <- result{objs: results, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+		return c.copyObjects(ctx, r.objs, dst)
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// getObjects returns the objects found for keys, keyed by the non-namespaced key.
+func (c *cache) getObjects(ctx context.Context, keys []string, elemType reflect.Type, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]any, error), opt Options) (results map[string]any, err error) {
+	if ttl > ttl.Truncate(time.Second) {
+		return nil, errors.WithStack(ErrIllegalTTL)
+	}
+
+	observe := c.metric.Observe()
+	defer func() {
+		for _, key := range keys {
+			observe(c.namespacedKey(key), MetricTypeGetCache, &err)
+		}
+	}()
+
+	items := make(map[string]*Item, len(keys))
+	// refreshKeys are not expired but should be reloaded ahead of expiry
+	var redisKeys, expiredKeys, missingKeys, refreshKeys []string
+
+	// try to retrieve from local cache first
+	for _, key := range keys {
+		it := c.mem.get(c.namespacedKey(key))
+		if it == nil {
+			redisKeys = append(redisKeys, key)
+			continue
+		}
+		if it.Expired() {
+			expiredKeys = append(expiredKeys, key)
+		} else if c.refreshEarly(c.namespacedKey(key), it, opt) {
+			refreshKeys = append(refreshKeys, key)
+		}
+		items[key] = it
+	}
+
+	// then retrieve the rest from redis in a single round trip
+	if len(redisKeys) > 0 {
+		namespacedKeys := make([]string, len(redisKeys))
+		for i, key := range redisKeys {
+			namespacedKeys[i] = c.namespacedKey(key)
+		}
+
+		var its []*Item
+		its, err = c.rds.mget(ctx, namespacedKeys, func() any {
+			return newObject(elemType)
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for i, it := range its {
+			key := redisKeys[i]
+			if it == nil {
+				missingKeys = append(missingKeys, key)
+				continue
+			}
+			if it.Expired() {
+				expiredKeys = append(expiredKeys, key)
+			} else {
+				// update memory cache since it is not previously found in mem
+				c.mem.set(namespacedKeys[i], it)
+				if c.refreshEarly(namespacedKeys[i], it, opt) {
+					refreshKeys = append(refreshKeys, key)
+				}
+			}
+			items[key] = it
+		}
+	}
+
+	// expired objects are reloaded together with the missing ones, get policy may differ by object type.
+	returnExpiredKeys := expiredKeys[:0]
+	for _, key := range expiredKeys {
+		if c.getPolicy(c.namespacedKey(key), opt) == GetPolicyReloadOnExpiry {
+			missingKeys = append(missingKeys, key)
+		} else {
+			returnExpiredKeys = append(returnExpiredKeys, key)
+		}
+	}
+	expiredKeys = returnExpiredKeys
+
+	if len(missingKeys) > 0 {
+		var loaded map[string]*Item
+		loaded, err = c.resetObjects(ctx, missingKeys, ttl, f, opt)
+		if err != nil {
+			return nil, err
+		}
+		for key, it := range loaded {
+			items[key] = it
+		}
+	}
+
+	// if expired and get policy is not ReloadOnExpiry, or refresh ahead of expiry, then do a async load.
+	if asyncKeys := append(expiredKeys, refreshKeys...); len(asyncKeys) > 0 {
+		c.goAsync(func() {
+			// async load metric
+			observe := c.metric.Observe()
+
+			// ctx may be canceled once GetObjects returns, keep its values only
+			asyncCtx := context.WithoutCancel(ctx)
+			_, resetErr := c.resetObjects(asyncCtx, asyncKeys, ttl, f, opt)
+			if resetErr != nil {
+				c.options.OnError(asyncCtx, errors.WithStack(resetErr))
+				return
+			}
+			for _, key := range asyncKeys {
+				observe(c.namespacedKey(key), MetricTypeAsyncLoad, nil)
+			}
+		})
+	}
+
+	results = make(map[string]any, len(items))
+	for key, it := range items {
+		// tombstones are absent from results
+		if !it.NotFound {
+			results[key] = it.Object
+		}
+	}
+	return
+}
+
+// resetObjects load fresh data for keys with a single call of loader function.
+// keys share the flights of resetObject, only keys not being loaded already are passed to loader, a concurrent GetObject on
+// one of them waits for the batch load, and the batch waits for the other keys, keys not returned by loader are ignored.
+func (c *cache) resetObjects(ctx context.Context, keys []string, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]any, error), opt Options) (map[string]*Item, error) {
+	namespacedKeys := make([]string, len(keys))
+	for i, key := range keys {
+		namespacedKeys[i] = c.namespacedKey(key)
+	}
+	flights, owned := c.joinFlights(namespacedKeys...)
+
+	var ownedKeys []string
+	for i, key := range keys {
+		if owned[i] {
+			ownedKeys = append(ownedKeys, key)
+		}
+	}
+
+	// owned flights are ended before waiting for the others, so that batches sharing keys never wait for each other
+	if len(ownedKeys) > 0 {
+		loaded, loadErr := c.loadObjects(ctx, ownedKeys, ttl, f, opt)
+		for i, key := range keys {
+			if !owned[i] {
+				continue
+			}
+			it, ok := loaded[key]
+			switch {
+			case loadErr != nil:
+				c.endFlight(namespacedKeys[i], flights[i], nil, loadErr)
+			case !ok:
+				c.endFlight(namespacedKeys[i], flights[i], nil, errors.WithStack(errNotLoaded))
+			default:
+				c.endFlight(namespacedKeys[i], flights[i], it, nil)
+			}
+		}
+	}
+
+	items := make(map[string]*Item, len(keys))
+	for i, key := range keys {
+		<-flights[i].done
+		if err := flights[i].err; err != nil {
+			if errors.Is(err, errNotLoaded) {
+				continue
+			}
+			return nil, err
+		}
+		items[key] = flights[i].it
+	}
+	return items, nil
+}
+
+// loadObjects call loader function and write the loaded objects to redis and in-memory, returned items are keyed by the non-namespaced key.
+func (c *cache) loadObjects(ctx context.Context, keys []string, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]any, error), opt Options) (items map[string]*Item, err error) {
+	// add metric for a fresh load
+	observe := c.metric.Observe()
+	defer func() {
+		for key := range items {
+			observe(c.namespacedKey(key), MetricTypeLoad, &err)
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch v := r.(type) {
+			case error:
+				err = errors.WithStack(v)
+			default:
+				err = errors.New(fmt.Sprint(r))
+			}
+			c.options.OnError(ctx, err)
+		}
+	}()
+
+	var results map[string]any
+	start := time.Now()
+	results, err = f(ctx, keys)
+	if err != nil {
+		return
+	}
+	delta := time.Since(start)
+
+	// the caller may have timed out meanwhile, the loaded objects must still be written and published
+	writeCtx := context.WithoutCancel(ctx)
+
+	// every item has its own ttl with jitter, tombstones have a different ttl.
+	written := make(map[string]*Item, len(keys))
+	bodies := make(map[string][]byte, len(keys))
+	ttls := make(map[string]time.Duration, len(keys))
+
+	items = make(map[string]*Item, len(keys))
+	for _, key := range keys {
+		o, ok := results[key]
+		if !ok {
+			continue
+		}
+
+		// use ttl of object type if not provided
+		namespacedKey := c.namespacedKey(key)
+		keyTTL := c.ttl(namespacedKey, ttl)
+		if e, ok := o.(error); ok && errors.Is(e, ErrNotFound) {
+			ttls[namespacedKey] = c.jitter(c.notFoundTTL(keyTTL, opt), opt)
+			items[key] = newNotFoundItem(ttls[namespacedKey])
+		} else {
+			ttls[namespacedKey] = c.jitter(keyTTL, opt)
+			items[key] = newItem(o, ttls[namespacedKey])
+		}
+
+		items[key].Delta = delta.Milliseconds()
+		written[namespacedKey] = items[key]
+
+		// encode first to know the size of item
+		if bodies[namespacedKey], err = c.rds.encode(namespacedKey, items[key]); err != nil {
+			return
+		}
+
+		// update local mem first
+		c.mem.set(namespacedKey, items[key])
+	}
+
+	if err = c.rds.mset(writeCtx, written, bodies); err != nil {
+		return
+	}
+
+	for namespacedKey, itemTTL := range ttls {
+		c.tag(writeCtx, namespacedKey, itemTTL, opt)
+	}
+
+	namespacedKeys := make([]string, 0, len(written))
+	for namespacedKey := range written {
+		namespacedKeys = append(namespacedKeys, namespacedKey)
+	}
+	if pubErr := c.notifyRefresh(writeCtx, c.updatePolicy(opt), namespacedKeys...); pubErr != nil {
+		c.options.OnError(writeCtx, errors.WithStack(pubErr))
+	}
+	return
+}
+
+// copyObjects deepcopy every object of src into the objs map.
+func (c *cache) copyObjects(ctx context.Context, src map[string]any, objs reflect.Value) error {
+	keyType, elemType := objs.Type().Key(), objs.Type().Elem()
+	for key, o := range src {
+		dst := reflect.New(elemType)
+		if err := c.copy(ctx, o, dst.Interface()); err != nil {
+			return err
+		}
+		objs.SetMapIndex(reflect.ValueOf(key).Convert(keyType), dst.Elem())
+	}
+	return nil
+}
+
+// newObject allocates a new object to unmarshal redis data of type t into, pointer types are allocated with their element type.
+func newObject(t reflect.Type) any {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return reflect.New(t).Interface()
+}
@@ -22,22 +22,45 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"math/rand"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/pkg/errors"
 	"github.com/seaguest/deepcopy"
 	"golang.org/x/sync/singleflight"
 )
 
 var (
-	ErrIllegalTTL = errors.New("illegal ttl, must be in whole numbers of seconds, no fractions")
+	ErrIllegalTTL  = errors.New("illegal ttl, must be in whole numbers of seconds, no fractions")
+	ErrIllegalObjs = errors.New("illegal objs, must be a non-nil map with string keys")
+	ErrClosed      = errors.New("cache is closed")
+	ErrCacheMiss   = errors.New("cache miss")
+
+	// ErrDecrypt is reported to OnError when an object read from redis can't be decrypted, it is treated as a miss.
+	ErrDecrypt = errors.New("decryption failed")
+
+	// ErrNotSupported is returned by features relying on an optional capability of RemoteStore which the store lacks.
+	ErrNotSupported = errors.New("not supported by the remote store")
+
+	// ErrNotFound can be returned by loader function to cache a tombstone, GetObject returns ErrNotFound until the tombstone expires.
+	ErrNotFound = errors.New("object not found")
 )
 
 const (
 	defaultNamespace = "default"
+
+	// markers of the messages published by notifyRefresh, other instances delete or reload the key.
+	refreshMarker = ":__refresh__:"
+	reloadMarker  = ":__reload__:"
+
+	// interval to check redis for the object loaded by the owner of the load lock
+	loadLockPollInterval = 50 * time.Millisecond
 )
 
 type Cache interface {
@@ -45,7 +68,44 @@ type Cache interface {
 	// suggest to use object_type#id as key or any other pattern which can easily extract object, aggregate metric for same object in onMetric
 	GetObject(ctx context.Context, key string, obj any, ttl time.Duration, f func() (any, error), opts ...Option) error
 
+	// GetObjectCtx same as GetObject with a context-aware loader function, f() gets ctx for a synchronous load,
+	// and a ctx detached from ctx cancellation but keeping its values for an async load.
+	GetObjectCtx(ctx context.Context, key string, obj any, ttl time.Duration, f func(ctx context.Context) (any, error), opts ...Option) error
+
+	// GetObjects batch version of GetObject, objs must be a map with string keys like map[string]*TestStruct, found objects are added to objs.
+	// loader function f() will be called once with all keys missing from both in-memory and redis, keys not returned by f() are absent from objs,
+	// a key mapped to ErrNotFound by f() is cached as a tombstone and absent from objs as well.
+	GetObjects(ctx context.Context, keys []string, objs any, ttl time.Duration, f func(missingKeys []string) (map[string]any, error), opts ...Option) error
+
+	// GetObjectsCtx same as GetObjects with a context-aware loader function, ctx is passed like GetObjectCtx.
+	GetObjectsCtx(ctx context.Context, keys []string, objs any, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]any, error), opts ...Option) error
+
+	// Set write obj to redis and in-memory with given ttl, other cache instances will be notified to drop their stale copy.
+	Set(ctx context.Context, key string, obj any, ttl time.Duration, opts ...Option) error
+
 	Delete(ctx context.Context, key string) error
+
+	// DeleteObjectType delete all keys of objectType, which are in format objectType{Separator}id, all cache instances will be notified.
+	// keys ending with {Separator}* are reserved for the notification.
+	DeleteObjectType(ctx context.Context, objectType string) error
+
+	// DeleteByTag delete all keys tagged with tag by GetObject or Set, all cache instances will be notified.
+	DeleteByTag(ctx context.Context, tag string) error
+
+	// Peek read the object of key from in-memory then redis, without calling any loader function nor updating any metric, an expired object is returned as well.
+	// returns ErrCacheMiss if key is cached nowhere, ErrNotFound for a tombstone.
+	Peek(ctx context.Context, key string, obj any) error
+
+	// Inspect returns the state of key in both in-memory and redis, without calling any loader function nor updating any metric.
+	Inspect(ctx context.Context, key string) (*Info, error)
+
+	// Touch push the expiration of key to now+ttl in both in-memory and redis without reloading, returns ErrCacheMiss if key is not in redis.
+	// 0 ttl is the ttl of the object type, like in Set and GetObject.
+	// other cache instances keep the expiration of their in-memory copy.
+	Touch(ctx context.Context, key string, ttl time.Duration) error
+
+	// Close stop all background goroutines and wait for in-flight async loads, all calls after Close return ErrClosed.
+	Close(ctx context.Context) error
 }
 
 type cache struct {
@@ -59,12 +119,47 @@ type cache struct {
 
 	sfg singleflight.Group
 
+	// loads in progress, namespacedKey -> flight
+	flightMu sync.Mutex
+	flights  map[string]*flight
+
 	metric Metrics
 
 	logger *slog.Logger
+
+	// mu protects the transition to closed
+	mu     sync.Mutex
+	closed atomic.Bool
+
+	// stop watchDelete, called on close
+	stopWatch context.CancelFunc
+
+	// closed when watchDelete exits
+	watchDone chan struct{}
+
+	// closed once watchDelete has subscribed the first time
+	subscribed     chan struct{}
+	subscribedOnce sync.Once
+
+	// tracks async loads
+	wg sync.WaitGroup
+
+	// number of loads in flight, async or not, see Testing.WaitLoads
+	inflight atomic.Int64
+
+	// identifies this instance in the messages it publishes
+	id string
+
+	// randMu protects rand which is not safe for concurrent use
+	randMu sync.Mutex
+	rand   *rand.Rand
 }
 
 func New(options ...Option) Cache {
+	return newCache(options...)
+}
+
+func newCache(options ...Option) *cache {
 	c := &cache{}
 	opts := newOptions(options...)
 
@@ -88,6 +183,11 @@ func New(options ...Option) Cache {
 		opts.GetPolicy = GetPolicyReturnExpired
 	}
 
+	// if update policy is not specified, other instances are not notified of a reload.
+	if opts.UpdatePolicy == 0 {
+		opts.UpdatePolicy = UpdatePolicyNoBroadcast
+	}
+
 	// set default CleanInterval to 10s if missing
 	if opts.CleanInterval == 0 {
 		opts.CleanInterval = time.Second * 10
@@ -95,17 +195,84 @@ func New(options ...Option) Cache {
 		panic("CleanInterval must be second at least")
 	}
 
+	// set default codec to json if missing
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+
 	if opts.OnError == nil {
 		panic("OnError is nil")
 	}
 
+	// redis with go-redis if a client is provided, otherwise with redigo
+	if opts.Store == nil {
+		switch {
+		case opts.GoRedisClient != nil:
+			opts.Store = NewGoRedisStore(opts.GoRedisClient)
+		case opts.GetConn != nil:
+			opts.Store = NewRedisStore(opts.GetConn)
+		default:
+			panic("GetConn, GoRedisClient or Store must be provided")
+		}
+	}
+
+	// a go-redis cluster client routes multi-key commands by their first key, keys must be grouped by slot
+	if store, ok := opts.Store.(*goRedisStore); ok && store.cluster() {
+		opts.Cluster = true
+	}
+
+	// hash tag by object type if not specified
+	// redis cluster hashes the first {...} of a key, which would be within the namespace
+	if opts.Cluster && strings.Contains(opts.Namespace, "{") {
+		panic("Namespace must not contain '{' in cluster mode")
+	}
+	if opts.Cluster && opts.HashTag == nil {
+		separator := opts.Separator
+		opts.HashTag = func(key string) string {
+			return strings.Split(key, separator)[0]
+		}
+	}
+
+	if opts.NotFoundTTL > opts.NotFoundTTL.Truncate(time.Second) {
+		panic("NotFoundTTL must be in whole numbers of seconds")
+	}
+
+	redisTTLFactors := make(map[string]int)
+	for objectType, config := range opts.ObjectTypes {
+		if config.TTL > config.TTL.Truncate(time.Second) {
+			panic("TTL of object type " + objectType + " must be in whole numbers of seconds")
+		}
+		if config.RedisTTLFactor > 0 {
+			redisTTLFactors[objectType] = config.RedisTTLFactor
+		}
+	}
+
+	if opts.TTLJitter < 0 || opts.TTLJitter >= 1 {
+		panic("TTLJitter must be in [0, 1)")
+	}
+
+	if opts.RandSource == nil {
+		opts.RandSource = rand.NewSource(time.Now().UnixNano())
+	}
+
 	c.options = opts
 	c.metric = opts.Metric
 	c.metric.namespace = opts.Namespace
 	c.metric.separator = opts.Separator
-	c.mem = newMemCache(opts.CleanInterval, c.metric)
-	c.rds = newRedisCache(opts.GetConn, opts.RedisTTLFactor, c.metric)
-	go c.watchDelete()
+	c.metric.cluster = opts.Cluster
+	c.mem = newMemCache(opts.CleanInterval, opts.MaxMemEntries, opts.MaxMemBytes, opts.ObjectTypes, c.metric)
+	c.rds = newRedisCache(opts.Store, opts.RedisTTLFactor, redisTTLFactors, opts.Codec, opts.Compressor, opts.CompressThreshold, opts.KeyProvider, opts.Cluster, c.metric)
+	c.rds.onError = func(err error) {
+		c.options.OnError(context.Background(), err)
+	}
+	c.rand = rand.New(opts.RandSource)
+	c.flights = make(map[string]*flight)
+	c.id = c.token()
+	c.watchDone = make(chan struct{})
+	c.subscribed = make(chan struct{})
+	var watchCtx context.Context
+	watchCtx, c.stopWatch = context.WithCancel(context.Background())
+	go c.watchDelete(watchCtx)
 
 	// Set up logger based on debug option
 	var logLevel slog.Leveler = slog.LevelInfo
@@ -119,23 +286,36 @@ func New(options ...Option) Cache {
 }
 
 func (c *cache) GetObject(ctx context.Context, key string, obj any, ttl time.Duration, f func() (any, error), opts ...Option) error {
+	return c.GetObjectCtx(ctx, key, obj, ttl, func(context.Context) (any, error) {
+		return f()
+	}, opts...)
+}
+
+func (c *cache) GetObjectCtx(ctx context.Context, key string, obj any, ttl time.Duration, f func(ctx context.Context) (any, error), opts ...Option) error {
 	opt := newOptions(opts...)
 
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
 	c.logger.Debug("[seaguest/cache] GetObject called", "key", key, "ttl", ttl)
 	defer c.logger.Debug("[seaguest/cache] GetObject completed", "key", key, "ttl", ttl, "obj", obj)
 
 	// is disabled, call loader function
 	if c.options.Disabled {
-		o, err := f()
+		o, err := f(ctx)
 		if err != nil {
 			return err
 		}
 		return c.copy(ctx, o, obj)
 	}
 
-	done := make(chan error)
+	// buffered, getObject must not block forever once ctx is done
+	done := make(chan error, 1)
 	var err error
+	c.inflight.Add(1)
 	go func() {
+		defer c.inflight.Add(-1)
 		done <- c.getObject(ctx, key, obj, ttl, f, opt)
 	}()
 
@@ -147,43 +327,68 @@ func (c *cache) GetObject(ctx context.Context, key string, obj any, ttl time.Dur
 	return err
 }
 
-func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Duration, f func() (any, error), opt Options) (err error) {
-	if ttl > ttl.Truncate(time.Second) {
+func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Duration, f func(ctx context.Context) (any, error), opt Options) (err error) {
+	if ttl > ttl.Truncate(time.Second) || opt.NotFoundTTL > opt.NotFoundTTL.Truncate(time.Second) {
 		return errors.WithStack(ErrIllegalTTL)
 	}
 
-	var expired bool
+	// refresh is true if a non-expired object is found and should be reloaded ahead of expiry,
+	// slide is true if a non-expired object is found and its expiration should be pushed forward.
+	var expired, refresh, slide bool
 	namespacedKey := c.namespacedKey(key)
 	defer c.metric.Observe()(namespacedKey, MetricTypeGetCache, &err)
 
-	// use GetCachePolicy from inout if provided, otherwise take from global options.
-	getPolicy := opt.GetPolicy
-	if getPolicy == 0 {
-		getPolicy = c.options.GetPolicy
+	// allocates a new object like obj, to read the object loaded by another instance
+	newObj := func() any {
+		return reflect.New(reflect.TypeOf(obj).Elem()).Interface()
 	}
 
+	// use ttl of object type if not provided
+	ttl = c.ttl(namespacedKey, ttl)
+	getPolicy := c.getPolicy(namespacedKey, opt)
+
 	var it *Item
 	defer func() {
 		if expired && getPolicy == GetPolicyReloadOnExpiry {
-			it, err = c.resetObject(ctx, namespacedKey, ttl, f, opt)
+			stale := it
+			it, err = c.resetObject(ctx, namespacedKey, ttl, f, newObj, opt)
+			if err != nil && c.serveStale(ctx, namespacedKey, stale, err, opt) {
+				it, err = stale, nil
+			}
 		}
 		// deepcopy before return
 		if err == nil {
-			err = c.copy(ctx, it.Object, obj)
+			if it.NotFound {
+				err = errors.WithStack(ErrNotFound)
+			} else {
+				err = c.copy(ctx, it.Object, obj)
+			}
 		}
 
-		// if expired and get policy is not ReloadOnExpiry, then do a async load.
-		if expired && getPolicy != GetPolicyReloadOnExpiry {
-			go func() {
+		if slide && err == nil {
+			c.goAsync(func() {
+				defer c.metric.Observe()(namespacedKey, MetricTypeTouch, nil)
+
+				if _, touchErr := c.touch(context.WithoutCancel(ctx), namespacedKey, c.jitter(ttl, opt)); touchErr != nil {
+					c.options.OnError(context.WithoutCancel(ctx), errors.WithStack(touchErr))
+				}
+			})
+		}
+
+		// if expired and get policy is not ReloadOnExpiry, or refresh ahead of expiry, then do a async load.
+		if (expired && getPolicy != GetPolicyReloadOnExpiry) || refresh {
+			c.goAsync(func() {
 				// async load metric
 				defer c.metric.Observe()(namespacedKey, MetricTypeAsyncLoad, nil)
 
-				_, resetErr := c.resetObject(ctx, namespacedKey, ttl, f, opt)
+				// ctx may be canceled once GetObject returns, keep its values only
+				asyncCtx := context.WithoutCancel(ctx)
+				_, resetErr := c.resetObject(asyncCtx, namespacedKey, ttl, f, newObj, opt)
 				if resetErr != nil {
-					c.options.OnError(ctx, errors.WithStack(resetErr))
+					c.options.OnError(asyncCtx, errors.WithStack(resetErr))
 					return
 				}
-			}()
+			})
 		}
 	}()
 
@@ -192,6 +397,9 @@ func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Dur
 	if it != nil {
 		if it.Expired() {
 			expired = true
+		} else {
+			refresh = c.refreshEarly(namespacedKey, it, opt)
+			slide = opt.SlidingExpiration && !it.NotFound
 		}
 		return
 	}
@@ -199,7 +407,7 @@ func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Dur
 	var itf interface{}
 	itf, err, _ = c.sfg.Do(namespacedKey+"_get", func() (interface{}, error) {
 		// try to retrieve from redis, return if found
-		v, redisErr := c.rds.get(namespacedKey, obj)
+		v, redisErr := c.rds.get(ctx, namespacedKey, obj)
 		if redisErr != nil {
 			return nil, errors.WithStack(redisErr)
 		}
@@ -209,10 +417,12 @@ func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Dur
 			} else {
 				// update memory cache since it is not previously found in mem
 				c.mem.set(namespacedKey, v)
+				refresh = c.refreshEarly(namespacedKey, v, opt)
+				slide = opt.SlidingExpiration && !v.NotFound
 			}
 			return v, nil
 		}
-		return c.resetObject(ctx, namespacedKey, ttl, f, opt)
+		return c.resetObject(ctx, namespacedKey, ttl, f, newObj, opt)
 	})
 	if err != nil {
 		return
@@ -221,76 +431,572 @@ func (c *cache) getObject(ctx context.Context, key string, obj any, ttl time.Dur
 	return
 }
 
-// resetObject load fresh data to redis and in-memory with loader function
-func (c *cache) resetObject(ctx context.Context, namespacedKey string, ttl time.Duration, f func() (any, error), opt Options) (*Item, error) {
-	itf, err, _ := c.sfg.Do(namespacedKey+"_reset", func() (it interface{}, err error) {
-		// add metric for a fresh load
-		defer c.metric.Observe()(namespacedKey, MetricTypeLoad, &err)
+// resetObject load fresh data to redis and in-memory with loader function, or wait for the load of namespacedKey in progress.
+// with LoadLock, the object loaded by another instance may be returned, newObj allocates the object to read it from redis.
+func (c *cache) resetObject(ctx context.Context, namespacedKey string, ttl time.Duration, f func(ctx context.Context) (any, error), newObj func() any, opt Options) (it *Item, err error) {
+	for {
+		flights, owned := c.joinFlights(namespacedKey)
+		fl := flights[0]
+		if owned[0] {
+			defer func() {
+				c.endFlight(namespacedKey, fl, it, err)
+			}()
+			return c.loadObject(ctx, namespacedKey, ttl, f, newObj, opt)
+		}
 
-		defer func() {
-			if r := recover(); r != nil {
-				switch v := r.(type) {
-				case error:
-					err = errors.WithStack(v)
-				default:
-					err = errors.New(fmt.Sprint(r))
-				}
-				c.options.OnError(ctx, err)
-			}
-		}()
+		<-fl.done
+		// not returned by the loader of a batch, load it with its own loader
+		if !errors.Is(fl.err, errNotLoaded) {
+			return fl.it, fl.err
+		}
+	}
+}
 
-		var o interface{}
-		o, err = f()
+// loadObject call loader function and write the loaded object to redis and in-memory.
+func (c *cache) loadObject(ctx context.Context, namespacedKey string, ttl time.Duration, f func(ctx context.Context) (any, error), newObj func() any, opt Options) (it *Item, err error) {
+	if lease := c.loadLock(opt); lease > 0 {
+		var (
+			unlock func()
+			loaded *Item
+		)
+		unlock, loaded, err = c.lockLoad(ctx, namespacedKey, lease, newObj)
 		if err != nil {
 			return
 		}
+		if loaded != nil {
+			it = loaded
+			return
+		}
+		if unlock != nil {
+			defer unlock()
+		}
+	}
 
-		// update local mem first
-		c.mem.set(namespacedKey, newItem(o, ttl))
+	// add metric for a fresh load
+	defer c.metric.Observe()(namespacedKey, MetricTypeLoad, &err)
 
-		it, err = c.rds.set(namespacedKey, o, ttl)
-		if err != nil {
-			return
+	defer func() {
+		if r := recover(); r != nil {
+			switch v := r.(type) {
+			case error:
+				err = errors.WithStack(v)
+			default:
+				err = errors.New(fmt.Sprint(r))
+			}
+			c.options.OnError(ctx, err)
+			err = recoveredError{err}
 		}
+	}()
+
+	var o interface{}
+	start := time.Now()
+	o, err = f(ctx)
+	delta := time.Since(start)
+
+	// the caller may have timed out meanwhile, the loaded object must still be written and published
+	writeCtx := context.WithoutCancel(ctx)
+
+	var item *Item
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// cache a tombstone to avoid calling loader again
+		ttl = c.jitter(c.notFoundTTL(ttl, opt), opt)
+		item = newNotFoundItem(ttl)
+		err = nil
+	case err != nil:
 		return
-	})
+	default:
+		ttl = c.jitter(ttl, opt)
+		item = newItem(o, ttl)
+	}
+	item.Delta = delta.Milliseconds()
+
+	// encode first to know the size of item
+	var body []byte
+	body, err = c.rds.encode(namespacedKey, item)
+	if err != nil {
+		return
+	}
+
+	// update local mem first
+	c.mem.set(namespacedKey, item)
+
+	err = c.rds.set(writeCtx, namespacedKey, item, body)
 	if err != nil {
-		return nil, err
+		return
+	}
+
+	c.tag(writeCtx, namespacedKey, ttl, opt)
+
+	if pubErr := c.notifyRefresh(writeCtx, c.updatePolicy(opt), namespacedKey); pubErr != nil {
+		c.options.OnError(writeCtx, errors.WithStack(pubErr))
 	}
-	return itf.(*Item), nil
+	it = item
+	return
+}
+
+// recoveredError is the error of a loader function which panicked, it is reported to OnError once recovered.
+type recoveredError struct {
+	error
+}
+
+func (e recoveredError) Unwrap() error {
+	return e.error
+}
+
+// Format keeps the stack trace of the wrapped error with %+v.
+func (e recoveredError) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), e.error)
+}
+
+// flight is a load in progress, shared by concurrent GetObject and GetObjects calls on the same key.
+type flight struct {
+	done chan struct{}
+	it   *Item
+	err  error
+}
+
+// joinFlights returns the flight of every key, owned is true for the flights started by this call, which must be ended with endFlight.
+// keys are claimed at once, a batch loads only the keys it owns, and waits for the others.
+func (c *cache) joinFlights(namespacedKeys ...string) (flights []*flight, owned []bool) {
+	c.flightMu.Lock()
+	defer c.flightMu.Unlock()
+
+	flights = make([]*flight, len(namespacedKeys))
+	owned = make([]bool, len(namespacedKeys))
+	for i, namespacedKey := range namespacedKeys {
+		fl, ok := c.flights[namespacedKey]
+		if !ok {
+			fl = &flight{done: make(chan struct{})}
+			c.flights[namespacedKey] = fl
+			owned[i] = true
+		}
+		flights[i] = fl
+	}
+	return
 }
 
-func (c *cache) DeleteFromMem(key string) {
+// endFlight set the result of fl and wake up its waiters, a new load of namespacedKey starts a new flight.
+func (c *cache) endFlight(namespacedKey string, fl *flight, it *Item, err error) {
+	c.flightMu.Lock()
+	delete(c.flights, namespacedKey)
+	c.flightMu.Unlock()
+
+	fl.it, fl.err = it, err
+	close(fl.done)
+}
+
+// Set write obj to redis first, then notify all other cache instances to delete their stale copy, and update local mem.
+func (c *cache) Set(ctx context.Context, key string, obj any, ttl time.Duration, opts ...Option) (err error) {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
+	if ttl > ttl.Truncate(time.Second) {
+		return errors.WithStack(ErrIllegalTTL)
+	}
+	opt := newOptions(opts...)
+
+	// nothing to write when disabled
+	if c.options.Disabled {
+		return nil
+	}
+
 	namespacedKey := c.namespacedKey(key)
-	c.mem.delete(namespacedKey)
+	defer c.metric.Observe()(namespacedKey, MetricTypeSetCache, &err)
+
+	ttl = c.jitter(c.ttl(namespacedKey, ttl), opt)
+	it := newItem(obj, ttl)
+	body, err := c.rds.encode(namespacedKey, it)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	err = c.rds.set(ctx, namespacedKey, it, body)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+
+	c.tag(ctx, namespacedKey, ttl, opt)
+
+	// tagged with the id of this instance, so that its own mem copy is kept
+	if pubErr := c.notifyRefresh(ctx, UpdatePolicyBroadcast, namespacedKey); pubErr != nil {
+		c.options.OnError(ctx, errors.WithStack(pubErr))
+	}
+
+	c.mem.set(namespacedKey, it)
+	return
+}
+
+// updatePolicy returns the update policy from input if provided, otherwise from global options.
+func (c *cache) updatePolicy(opt Options) UpdateCachePolicy {
+	if opt.UpdatePolicy != 0 {
+		return opt.UpdatePolicy
+	}
+	return c.options.UpdatePolicy
+}
+
+// loadLock returns the lease of load lock, 0 if disabled.
+func (c *cache) loadLock(opt Options) time.Duration {
+	// use LoadLock from input if provided, otherwise take from global options.
+	if opt.LoadLock > 0 {
+		return opt.LoadLock
+	}
+	return c.options.LoadLock
+}
+
+// lockLoad acquire the load lease of namespacedKey, unlock must be called once loaded if acquired.
+// otherwise it waits for the object loaded by the lease owner, and returns the expired object found in redis on timeout if any.
+// loader function should be called if both unlock and returned item are nil.
+func (c *cache) lockLoad(ctx context.Context, namespacedKey string, lease time.Duration, newObj func() any) (unlock func(), it *Item, err error) {
+	lockKey := c.lockKey(namespacedKey)
+	token := c.token()
+
+	observe := c.metric.Observe()
+	acquired, err := c.rds.lock(ctx, lockKey, token, lease)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if acquired {
+		observe(namespacedKey, MetricTypeLockAcquired, nil)
+		return func() {
+			// released even if the caller has timed out, not to hold the lease until it expires
+			unlockCtx := context.WithoutCancel(ctx)
+			if unlockErr := c.rds.unlock(unlockCtx, lockKey, token); unlockErr != nil {
+				c.options.OnError(unlockCtx, errors.WithStack(unlockErr))
+			}
+		}, nil, nil
+	}
+
+	timer := time.NewTimer(lease)
+	defer timer.Stop()
+	ticker := time.NewTicker(min(lease, loadLockPollInterval))
+	defer ticker.Stop()
+
+	var stale *Item
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, errors.WithStack(ctx.Err())
+		case <-timer.C:
+			c.metric.Observe()(namespacedKey, MetricTypeLockTimeout, nil)
+			return nil, stale, nil
+		case <-ticker.C:
+			v, peekErr := c.rds.peek(ctx, namespacedKey, newObj())
+			if peekErr != nil {
+				return nil, nil, errors.WithStack(peekErr)
+			}
+			if v == nil {
+				continue
+			}
+			if v.Expired() {
+				stale = v
+				continue
+			}
+
+			// loaded by the lease owner
+			c.mem.set(namespacedKey, v)
+			observe(namespacedKey, MetricTypeLockWait, nil)
+			return nil, v, nil
+		}
+	}
 }
 
-func (c *cache) DeleteFromRedis(key string) error {
+// token returns a random value identifying the owner of a lease.
+func (c *cache) token() string {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(c.rand.Uint64(), 36)
+}
+
+func (c *cache) Touch(ctx context.Context, key string, ttl time.Duration) (err error) {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
+	if ttl < 0 || ttl > ttl.Truncate(time.Second) {
+		return errors.WithStack(ErrIllegalTTL)
+	}
+
+	// nothing cached when disabled
+	if c.options.Disabled {
+		return nil
+	}
+
 	namespacedKey := c.namespacedKey(key)
-	return c.rds.delete(namespacedKey)
+	defer c.metric.Observe()(namespacedKey, MetricTypeTouch, &err)
+
+	// use ttl of object type if not provided
+	found, err := c.touch(ctx, namespacedKey, c.ttl(namespacedKey, ttl))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !found {
+		return errors.WithStack(ErrCacheMiss)
+	}
+	return nil
+}
+
+// touch set the expiration of namespacedKey to now+ttl in redis then in-memory, returns false if not found in redis.
+func (c *cache) touch(ctx context.Context, namespacedKey string, ttl time.Duration) (bool, error) {
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl).UnixMilli()
+	}
+
+	found, err := c.rds.touch(ctx, namespacedKey, expireAt, c.rds.redisTTL(namespacedKey, ttl))
+	if err != nil || !found {
+		return false, err
+	}
+	c.mem.touch(namespacedKey, expireAt)
+	return true, nil
+}
+
+// refreshEarly returns true if it should be reloaded ahead of expiry, following XFetch probabilistic early expiration.
+func (c *cache) refreshEarly(namespacedKey string, it *Item, opt Options) bool {
+	// use EarlyRefresh from input if provided, otherwise take from global options.
+	beta := opt.EarlyRefresh
+	if beta == 0 {
+		beta = c.options.EarlyRefresh
+	}
+	// disabled by default, don't draw on every hit
+	if beta <= 0 || !it.refreshEarly(beta, 1-c.float64()) {
+		return false
+	}
+
+	c.metric.Observe()(namespacedKey, MetricTypeEarlyRefresh, nil)
+	return true
+}
+
+// jitter returns ttl randomized within ±TTLJitter*ttl, 0 ttl is kept as no expiration.
+func (c *cache) jitter(ttl time.Duration, opt Options) time.Duration {
+	// use TTLJitter from input if provided, otherwise take from global options.
+	fraction := opt.TTLJitter
+	if fraction == 0 {
+		fraction = c.options.TTLJitter
+	}
+	if ttl <= 0 || fraction <= 0 || fraction >= 1 {
+		return ttl
+	}
+
+	delta := time.Duration(float64(ttl) * fraction * (2*c.float64() - 1))
+	// never go below 1ms, which is the precision of ExpireAt and redis PX
+	return max(ttl+delta, time.Millisecond)
+}
+
+// float64 returns a random number in [0.0, 1.0) from RandSource.
+func (c *cache) float64() float64 {
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+
+	return c.rand.Float64()
+}
+
+// serveStale returns true if the expired item can be returned instead of the reload error, the error is reported to OnError.
+func (c *cache) serveStale(ctx context.Context, namespacedKey string, stale *Item, err error, opt Options) bool {
+	// use StaleIfError from input if provided, otherwise take from global options.
+	maxStale := opt.StaleIfError
+	if maxStale == 0 {
+		maxStale = c.options.StaleIfError
+	}
+	if maxStale <= 0 || time.Now().UnixMilli()-stale.ExpireAt > maxStale.Milliseconds() {
+		return false
+	}
+
+	// a panic is reported once recovered
+	if !errors.As(err, new(recoveredError)) {
+		c.options.OnError(ctx, errors.WithStack(err))
+	}
+	c.metric.Observe()(namespacedKey, MetricTypeStaleIfError, nil)
+	return true
+}
+
+// notFoundTTL returns the ttl of tombstone, from input if provided, otherwise from global options, ttl of the call by default.
+func (c *cache) notFoundTTL(ttl time.Duration, opt Options) time.Duration {
+	if opt.NotFoundTTL > 0 {
+		return opt.NotFoundTTL
+	}
+	if c.options.NotFoundTTL > 0 {
+		return c.options.NotFoundTTL
+	}
+	return ttl
 }
 
 // Delete notify all cache instances to delete cache key
 func (c *cache) Delete(ctx context.Context, key string) (err error) {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
 	namespacedKey := c.namespacedKey(key)
 	defer c.metric.Observe()(namespacedKey, MetricTypeDeleteCache, &err)
 
 	// delete redis, then pub to delete cache
-	if err = c.rds.delete(namespacedKey); err != nil {
+	if err = c.rds.delete(ctx, namespacedKey); err != nil {
 		err = errors.WithStack(err)
 		return
 	}
 
-	conn := c.options.GetConn()
-	defer conn.Close()
+	err = c.notifyDelete(ctx, namespacedKey)
+	if err != nil {
+		c.options.OnError(ctx, errors.WithStack(err))
+	}
+	return
+}
+
+// DeleteByTag delete all keys tagged with tag from redis, then notify all cache instances to delete them.
+func (c *cache) DeleteByTag(ctx context.Context, tag string) (err error) {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
 
-	_, err = conn.Do("PUBLISH", c.deleteChannel(), namespacedKey)
+	tagKey := c.tagKey(tag)
+	defer c.metric.Observe()(tagKey, MetricTypeDeleteTag, &err)
+
+	var keys []string
+	keys, err = c.rds.untag(ctx, tagKey)
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	if err = c.rds.deleteMulti(ctx, keys); err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+
+	err = c.notifyDelete(ctx, keys...)
 	if err != nil {
 		c.options.OnError(ctx, errors.WithStack(err))
 	}
 	return
 }
 
+// DeleteObjectType delete all keys of objectType from redis batch by batch, then notify all cache instances with a wildcard message to delete them.
+func (c *cache) DeleteObjectType(ctx context.Context, objectType string) (err error) {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
+	// not a key, no hash tag
+	prefix := c.options.Namespace + ":" + objectType + c.options.Separator
+	defer c.metric.Observe()(prefix, MetricTypeDeleteType, &err)
+
+	err = c.rds.scan(ctx, escapePattern(prefix)+"*", func(keys []string) error {
+		return c.rds.deleteMulti(ctx, keys)
+	})
+	if err != nil {
+		err = errors.WithStack(err)
+		return
+	}
+
+	err = c.notifyDelete(ctx, prefix+"*")
+	if err != nil {
+		c.options.OnError(ctx, errors.WithStack(err))
+	}
+	return
+}
+
+// tag add namespacedKey to the tags of opt, tags live in redis at least as long as namespacedKey.
+// namespacedKey is already cached, a failure is reported to OnError and DeleteByTag may miss it until it expires.
+func (c *cache) tag(ctx context.Context, namespacedKey string, ttl time.Duration, opt Options) {
+	if len(opt.Tags) == 0 {
+		return
+	}
+
+	tagKeys := make([]string, len(opt.Tags))
+	for i, tag := range opt.Tags {
+		tagKeys[i] = c.tagKey(tag)
+	}
+	if err := c.rds.tag(ctx, namespacedKey, tagKeys, ttl); err != nil {
+		c.options.OnError(ctx, errors.WithStack(err))
+	}
+}
+
+// notifyDelete publish namespacedKeys to the delete channel, all cache instances will delete them from mem.
+func (c *cache) notifyDelete(ctx context.Context, namespacedKeys ...string) error {
+	return c.publish(ctx, namespacedKeys...)
+}
+
+// notifyRefresh notify other cache instances that namespacedKeys have been reloaded or written, according to updatePolicy.
+func (c *cache) notifyRefresh(ctx context.Context, updatePolicy UpdateCachePolicy, namespacedKeys ...string) error {
+	var marker string
+	switch updatePolicy {
+	case UpdatePolicyBroadcast:
+		marker = refreshMarker
+	case UpdatePolicyBroadcastReload:
+		marker = reloadMarker
+	default:
+		return nil
+	}
+	if len(namespacedKeys) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(namespacedKeys))
+	for i, namespacedKey := range namespacedKeys {
+		msgs[i] = c.options.Namespace + marker + c.id + ":" + namespacedKey
+	}
+	return c.publish(ctx, msgs...)
+}
+
+// publish msgs to the delete channel.
+func (c *cache) publish(ctx context.Context, msgs ...string) error {
+	return c.options.Store.Publish(ctx, c.deleteChannel(), msgs...)
+}
+
+// onRefresh apply a message published by notifyRefresh of another instance, returns false if msg is not such a message.
+func (c *cache) onRefresh(msg string) bool {
+	for _, marker := range []string{refreshMarker, reloadMarker} {
+		rest, ok := strings.CutPrefix(msg, c.options.Namespace+marker)
+		if !ok {
+			continue
+		}
+
+		origin, namespacedKey, _ := strings.Cut(rest, ":")
+		switch {
+		case origin == c.id:
+			// reloaded by this instance, already up to date
+		case marker == reloadMarker:
+			// redis is read asynchronously, not to delay the messages received after it
+			c.goAsync(func() {
+				c.reload(namespacedKey)
+			})
+		default:
+			c.mem.delete(namespacedKey)
+		}
+		return true
+	}
+	return false
+}
+
+// reload re-read namespacedKey from redis if cached in mem, keys not cached are not loaded.
+// the reloaded item is dropped if namespacedKey has been set or deleted meanwhile.
+func (c *cache) reload(namespacedKey string) {
+	old := c.mem.peek(namespacedKey)
+	if old == nil {
+		return
+	}
+
+	// the object type is only known from the cached object, drop tombstones which have none.
+	if old.Object == nil {
+		c.mem.replace(namespacedKey, old, nil)
+		return
+	}
+
+	it, err := c.rds.get(context.Background(), namespacedKey, newObject(reflect.TypeOf(old.Object)))
+	if err != nil {
+		c.options.OnError(context.Background(), errors.WithStack(err))
+	}
+	// dropped if it could not be read, it is nil then
+	c.mem.replace(namespacedKey, old, it)
+}
+
 // copy object to return, to avoid dirty data
 func (c *cache) copy(ctx context.Context, src, dst any) (err error) {
 	defer func() {
@@ -313,39 +1019,128 @@ func (c *cache) copy(ctx context.Context, src, dst any) (err error) {
 	return nil
 }
 
+// namespacedKey returns namespace:key, followed by the hash tag of key in cluster mode so that redis cluster places it by its hash tag.
+// the hash tag is a suffix, so that keys of an object type still share the prefix namespace:objectType{separator}.
+// redis cluster hashes the first {...} of a key, a key containing '{' is placed by its own braces rather than its hash tag.
 func (c *cache) namespacedKey(key string) string {
+	if c.options.Cluster {
+		return c.options.Namespace + ":" + key + "{" + c.options.HashTag(key) + "}"
+	}
 	return c.options.Namespace + ":" + key
 }
 
+// escapePattern escape special characters of redis glob-style pattern.
+func escapePattern(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\', '^', '-':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (c *cache) tagKey(tag string) string {
+	return c.options.Namespace + ":tag:" + tag
+}
+
+func (c *cache) lockKey(namespacedKey string) string {
+	return c.options.Namespace + ":lock:" + strings.TrimPrefix(namespacedKey, c.options.Namespace+":")
+}
+
 func (c *cache) deleteChannel() string {
 	return c.options.Namespace + ":delete_channel"
 }
 
-// watchDelete watch the delete channel and delete the cache from mem
-func (c *cache) watchDelete() {
-	ctx := context.Background()
-begin:
-	conn := c.options.GetConn()
-	defer conn.Close()
+// Close stop the janitor of mem, unsubscribe the delete channel and wait for in-flight async loads.
+func (c *cache) Close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed.Load() {
+		c.mu.Unlock()
+		return errors.WithStack(ErrClosed)
+	}
+	c.closed.Store(true)
+	c.mu.Unlock()
 
-	psc := redis.PubSubConn{Conn: conn}
-	if err := psc.Subscribe(c.deleteChannel()); err != nil {
-		c.options.OnError(ctx, errors.WithStack(err))
+	// watchDelete exits once unsubscribed
+	c.stopWatch()
+	c.mem.close()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		<-c.watchDone
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// goAsync run f in a new goroutine which will be waited by Close, f is dropped if cache is closed.
+func (c *cache) goAsync(f func()) {
+	c.mu.Lock()
+	if c.closed.Load() {
+		c.mu.Unlock()
 		return
 	}
+	c.wg.Add(1)
+	c.inflight.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+		defer c.inflight.Add(-1)
+		f()
+	}()
+}
+
+// watchDelete watch the delete channel and delete the cache from mem, until stopWatch is called.
+func (c *cache) watchDelete(ctx context.Context) {
+	defer close(c.watchDone)
 
 	for {
-		switch v := psc.Receive().(type) {
-		case redis.Message:
-			key := string(v.Data)
-			c.mem.delete(key)
-		case error:
-			c.options.OnError(ctx, errors.WithStack(v))
-			time.Sleep(time.Second) // Wait for a second before attempting to receive messages again
-			if strings.Contains(v.Error(), "use of closed network connection") || strings.Contains(v.Error(), "connect: connection refused") {
-				// if connection becomes invalid, then restart watch with new conn
-				goto begin
-			}
+		wait, err := c.options.Store.Subscribe(ctx, c.deleteChannel(), c.receive)
+		if err == nil {
+			c.subscribedOnce.Do(func() {
+				close(c.subscribed)
+			})
+			err = wait()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.options.OnError(ctx, errors.WithStack(err))
+		}
+
+		// wait for a second before subscribing again
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
 		}
 	}
 }
+
+// receive handle a message of the delete channel.
+func (c *cache) receive(msg string) {
+	if c.options.onMessage != nil && c.options.onMessage(msg) {
+		return
+	}
+	if c.onRefresh(msg) {
+		return
+	}
+	// wildcard message of DeleteObjectType
+	if strings.HasSuffix(msg, c.options.Separator+"*") {
+		c.mem.deletePrefix(strings.TrimSuffix(msg, "*"))
+		return
+	}
+	c.mem.delete(msg)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -113,15 +114,32 @@ var _ = Describe("cache stress", func() {
 			}
 		})
 
+		AfterEach(func() {
+			closeMocks()
+		})
+
 		Context("stress test", func() {
 			bgCtx := context.Background()
 			It("stress test", func() {
 				mock := newMockCache("stress_test#1", time.Millisecond*1200, time.Second, false, cache.GetPolicyReloadOnExpiry)
 
+				// stopped before the mock is closed
+				stop := make(chan struct{})
+				var wg sync.WaitGroup
+
 				for j := 0; j < 100; j++ {
+					wg.Add(1)
 					go func(id int) {
+						defer GinkgoRecover()
+						defer wg.Done()
 						for {
-							ctx, _ := context.WithTimeout(bgCtx, time.Second*2)
+							select {
+							case <-stop:
+								return
+							default:
+							}
+
+							ctx, cancel := context.WithTimeout(bgCtx, time.Second*2)
 							cs := cs1
 							cs.ID = id
 
@@ -132,6 +150,7 @@ var _ = Describe("cache stress", func() {
 								cs.ID = id
 								return &cs, nil
 							})
+							cancel()
 							if err != nil {
 								log.Println(err)
 							}
@@ -143,9 +162,18 @@ var _ = Describe("cache stress", func() {
 				}
 
 				for j := 0; j < 100; j++ {
+					wg.Add(1)
 					go func(id int) {
+						defer GinkgoRecover()
+						defer wg.Done()
 						for {
-							ctx, _ := context.WithTimeout(bgCtx, time.Second*2)
+							select {
+							case <-stop:
+								return
+							default:
+							}
+
+							ctx, cancel := context.WithTimeout(bgCtx, time.Second*2)
 							cs := cs2
 							cs.ID = id
 
@@ -156,6 +184,7 @@ var _ = Describe("cache stress", func() {
 								cs.ID = id
 								return &cs, nil
 							})
+							cancel()
 							if err != nil {
 								log.Println(err)
 							}
@@ -167,6 +196,8 @@ var _ = Describe("cache stress", func() {
 				}
 
 				time.Sleep(time.Second * 10)
+				close(stop)
+				wg.Wait()
 			})
 		})
 	})
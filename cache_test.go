@@ -1,22 +1,41 @@
 package cache_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"log"
-	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	goredis "github.com/redis/go-redis/v9"
 	"github.com/seaguest/cache"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type TestStruct struct {
 	Name string
 }
 
+// SizedStruct reports its own size
+type SizedStruct struct {
+	Name string
+}
+
+func (s *SizedStruct) Size() int {
+	return 1000
+}
+
+// upper bound of the time spent in cache by an operation without load, generous enough for -race
+const elapsedSlack = time.Millisecond * 500
+
 type metric struct {
 	Key         string
 	Type        string
@@ -38,7 +57,44 @@ type mockCache struct {
 	delay      time.Duration
 }
 
-func newMockCache(key string, delay, ci time.Duration, checkMetric bool, getPolicy cache.GetCachePolicy) mockCache {
+// slotStore records the keys of each MGet call.
+type slotStore struct {
+	cache.RemoteStore
+
+	mu    sync.Mutex
+	mgets [][]string
+}
+
+func (s *slotStore) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	s.mu.Lock()
+	s.mgets = append(s.mgets, keys)
+	s.mu.Unlock()
+	return s.RemoteStore.MGet(ctx, keys)
+}
+
+// coreStore only has the methods of RemoteStore, none of the optional capabilities.
+type coreStore struct {
+	cache.RemoteStore
+}
+
+// mocks created by the running spec, closed once it ends
+var mocks []mockCache
+
+// closeMocks close the mocks created by the running spec, so that they stop receiving the messages of later specs.
+func closeMocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, mock := range mocks {
+		// some specs close their mock themselves
+		if err := mock.ehCache.Close(ctx); err != nil && !errors.Is(err, cache.ErrClosed) {
+			Fail(err.Error())
+		}
+	}
+	mocks = nil
+}
+
+func newMockCache(key string, delay, ci time.Duration, checkMetric bool, getPolicy cache.GetCachePolicy, opts ...cache.Option) mockCache {
 	mock := mockCache{}
 	pool := &redis.Pool{
 		MaxIdle:     2,
@@ -53,9 +109,17 @@ func newMockCache(key string, delay, ci time.Duration, checkMetric bool, getPoli
 			return redis.Dial("tcp", "127.0.0.1:7379")
 		},
 	}
+	backend := cache.GetConn(pool.Get)
+	if useGoRedis {
+		backend = cache.GoRedisClient(goredis.NewClient(&goredis.Options{
+			Addr:     "127.0.0.1:7379",
+			PoolSize: 5,
+		}))
+	}
+
 	metricChan := make(chan metric, 20)
-	mock.tester, mock.ehCache = cache.NewForTesting(
-		cache.GetConn(pool.Get),
+	mock.tester, mock.ehCache = cache.NewForTesting(append([]cache.Option{
+		backend,
 		cache.CleanInterval(ci),
 		cache.Separator("#"),
 		cache.GetPolicy(getPolicy),
@@ -77,18 +141,42 @@ func newMockCache(key string, delay, ci time.Duration, checkMetric bool, getPoli
 		cache.OnError(func(ctx context.Context, err error) {
 			log.Printf("OnError:%+v", err)
 		}),
-	)
+	}, opts...)...)
 	mock.metricChan = metricChan
 	mock.key = key
 	mock.val = &TestStruct{Name: "value for" + key}
 	mock.delay = delay
+	mocks = append(mocks, mock)
 	return mock
 }
 
+// useGoRedis makes newMockCache use redis with go-redis instead of redigo
+var useGoRedis bool
+
 var _ = Describe("cache test", func() {
+	cacheSpecs()
+})
+
+// the same specs pass with go-redis
+var _ = Describe("cache test with go-redis", func() {
+	BeforeEach(func() {
+		useGoRedis = true
+	})
+	AfterEach(func() {
+		useGoRedis = false
+	})
+
+	cacheSpecs()
+})
+
+func cacheSpecs() {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
 	Context("cache unit test", func() {
+		AfterEach(func() {
+			closeMocks()
+		})
+
 		Context("Test loadFunc", func() {
 			It("loadFunc succeed", func() {
 				mock := newMockCache("load_func_succeed#1", time.Millisecond*1200, time.Second, true, cache.GetPolicyReturnExpired)
@@ -109,23 +197,22 @@ var _ = Describe("cache test", func() {
 				Ω(&v).To(Equal(mock.val))
 
 				// make sure redis pub finished
-				time.Sleep(time.Millisecond * 10)
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss, cache.MetricTypeSetMem, cache.MetricTypeSetRedis,
-					cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeSetMem}
+					cache.MetricTypeLoad, cache.MetricTypeGetCache}
 
 				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 					}
 				}
 			})
@@ -149,13 +236,11 @@ var _ = Describe("cache test", func() {
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss}
 				for _, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					default:
-					}
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 				}
 			})
 
@@ -167,7 +252,6 @@ var _ = Describe("cache test", func() {
 				panicMsg := "panic string"
 				loadFunc := func() (interface{}, error) {
 					panic(panicMsg)
-					return mock.val, nil
 				}
 
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
@@ -179,13 +263,11 @@ var _ = Describe("cache test", func() {
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss}
 				for _, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					default:
-					}
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 				}
 			})
 
@@ -197,7 +279,6 @@ var _ = Describe("cache test", func() {
 				panicErr := errors.New("panic error")
 				loadFunc := func() (interface{}, error) {
 					panic(panicErr)
-					return mock.val, nil
 				}
 
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
@@ -209,13 +290,11 @@ var _ = Describe("cache test", func() {
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss}
 				for _, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					default:
-					}
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 				}
 			})
 
@@ -237,18 +316,66 @@ var _ = Describe("cache test", func() {
 				Ω(err).To(MatchError(context.DeadlineExceeded))
 
 				// must wait goroutine to exit successfully, otherwise the other test will receive the redis-pub notification
-				time.Sleep(time.Millisecond * 300)
+				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+				Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss}
 				for _, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
+				}
+			})
+
+			It("loadFunc timeout still written", func() {
+				mock := newMockCache("load_func_timeout_written#1", time.Millisecond*1200, time.Second, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				loadFunc := func() (interface{}, error) {
+					time.Sleep(mock.delay)
+					return mock.val, nil
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc, cache.LoadLock(time.Second*5))
+				Ω(err).To(MatchError(context.DeadlineExceeded))
+
+				ctx, cancel = context.WithTimeout(context.Background(), time.Second*10)
+				defer cancel()
+				Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				// written to redis although the caller timed out
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).ToNot(BeNil())
+				Ω(it.Object).To(Equal(mock.val))
+
+				// the lease is released, the next load acquires it without waiting
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+				mock.tester.ResetMetrics()
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				}, cache.LoadLock(time.Second*5))
+				Ω(err).ToNot(HaveOccurred())
+
+				var types []string
+				for _, m := range mock.tester.Metrics() {
+					if m.Key == mock.key {
+						types = append(types, m.MetricType)
 					}
 				}
+				Ω(types).To(ContainElement(cache.MetricTypeLockAcquired))
+				Ω(types).ToNot(ContainElement(cache.MetricTypeLockTimeout))
 			})
 		})
 
@@ -272,7 +399,7 @@ var _ = Describe("cache test", func() {
 				Ω(&v).To(Equal(mock.val))
 
 				// make sure redis pub finished, mem get updated
-				time.Sleep(time.Millisecond * 10)
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 				mock.tester.DeleteFromMem(mock.key)
 
 				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
@@ -282,7 +409,7 @@ var _ = Describe("cache test", func() {
 				Ω(&v).To(Equal(mock.val))
 
 				// make sure redis pub finished, mem get updated
-				time.Sleep(time.Millisecond * 10)
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
 					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss,
@@ -290,17 +417,16 @@ var _ = Describe("cache test", func() {
 				}
 
 				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 					}
 				}
 			})
@@ -324,8 +450,8 @@ var _ = Describe("cache test", func() {
 			Ω(err).ToNot(HaveOccurred())
 			Ω(&v).To(Equal(mock.val))
 
-			// wait redis expired
-			time.Sleep(time.Millisecond * 1010)
+			// expire redis
+			Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
 			mock.tester.DeleteFromMem(mock.key)
 
 			ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
@@ -334,26 +460,26 @@ var _ = Describe("cache test", func() {
 			Ω(err).ToNot(HaveOccurred())
 			Ω(&v).To(Equal(mock.val))
 
-			// make sure redis pub finished, mem get updated
-			time.Sleep(mock.delay + time.Millisecond*10)
+			// wait last async load finish, make sure redis pub finished
+			Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+			Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 			metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
 				cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss,
-				cache.MetricTypeGetRedisExpired, cache.MetricTypeGetCache, cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeAsyncLoad, cache.MetricTypeSetMem,
+				cache.MetricTypeGetRedisExpired, cache.MetricTypeGetCache, cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeAsyncLoad,
 			}
 
 			for idx, metricType := range metricList {
-				select {
-				case mc := <-mock.metricChan:
-					Ω(mc.Key).To(Equal(mock.key))
-					Ω(mc.Type).To(Equal(metricType))
-					if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
-						// the first get_cache should be same as delay
-						Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-					} else {
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					}
-				default:
+				var mc metric
+				Ω(mock.metricChan).To(Receive(&mc))
+				Ω(mc.Key).To(Equal(mock.key))
+				Ω(mc.Type).To(Equal(metricType))
+				if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
+					// a get_cache waiting for a load includes it
+					Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+				} else {
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 				}
 			}
 		})
@@ -378,7 +504,7 @@ var _ = Describe("cache test", func() {
 				Ω(&v).To(Equal(mock.val))
 
 				// make sure redis pub finished
-				time.Sleep(time.Millisecond * 10)
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 				defer cancel()
@@ -391,17 +517,16 @@ var _ = Describe("cache test", func() {
 				}
 
 				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 					}
 				}
 			})
@@ -424,8 +549,8 @@ var _ = Describe("cache test", func() {
 				Ω(err).ToNot(HaveOccurred())
 				Ω(&v).To(Equal(mock.val))
 
-				// wait 1100 ms to expire mem
-				time.Sleep(time.Millisecond * 1100)
+				// expire mem
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
 
 				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 				defer cancel()
@@ -433,26 +558,26 @@ var _ = Describe("cache test", func() {
 				Ω(err).ToNot(HaveOccurred())
 				Ω(&v).To(Equal(mock.val))
 
-				// wait last async load finish
-				time.Sleep(mock.delay + time.Millisecond*10)
+				// wait last async load finish, make sure redis pub finished
+				Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
 					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeGetMemExpired, cache.MetricTypeGetCache,
-					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeAsyncLoad, cache.MetricTypeSetMem,
+					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeAsyncLoad,
 				}
 
 				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && idx == 7) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 					}
 				}
 			})
@@ -475,8 +600,8 @@ var _ = Describe("cache test", func() {
 				Ω(err).ToNot(HaveOccurred())
 				Ω(&v).To(Equal(mock.val))
 
-				// wait 1100 ms to expire mem
-				time.Sleep(time.Millisecond * 1100)
+				// expire mem
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
 
 				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 				defer cancel()
@@ -484,25 +609,25 @@ var _ = Describe("cache test", func() {
 				Ω(err).ToNot(HaveOccurred())
 				Ω(&v).To(Equal(mock.val))
 
-				// wait last async load finish
-				time.Sleep(mock.delay + time.Millisecond*10)
+				// wait last async load finish, make sure redis pub finished
+				Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
 				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
 					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeGetMemExpired,
 					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache}
 
 				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 12)) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 12)) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
 					}
 				}
 			})
@@ -513,128 +638,1878 @@ var _ = Describe("cache test", func() {
 				mock := newMockCache("delete_ok#1", time.Millisecond*1200, time.Second*1, true, cache.GetPolicyReturnExpired)
 				mock.tester.DeleteFromRedis(mock.key)
 				mock.tester.DeleteFromMem(mock.key)
-				mock.ehCache.Delete(context.Background(), mock.key)
 
-				// wait redis-pub received
-				time.Sleep(time.Millisecond * 10)
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+				Ω(mock.ehCache.Delete(ctx, mock.key)).ToNot(HaveOccurred())
 
-				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteCache, cache.MetricTypeDeleteMem}
+				// wait redis-pub received
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
 
-				for _, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-					default:
-					}
+				var types []string
+				for len(mock.metricChan) > 0 {
+					mc := <-mock.metricChan
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
+					types = append(types, mc.Type)
 				}
+				Ω(types).To(HaveLen(5))
+				Ω(types[:3]).To(Equal([]string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeDeleteRedis}))
+				// del_mem on receipt of the message may be observed before Delete returns
+				Ω(types[3:]).To(ConsistOf(cache.MetricTypeDeleteCache, cache.MetricTypeDeleteMem))
 			})
 		})
 
-		Context("Test hit EXPIRED with reloadOnExpiry", func() {
-			It("mem hit expired reload", func() {
-				mock := newMockCache("mem_hit_expired_reload#1", time.Millisecond*1200, time.Second*5, true, cache.GetPolicyReloadOnExpiry)
+		Context("Test set", func() {
+			It("set ok", func() {
+				mock := newMockCache("set_ok#1", time.Millisecond*1200, time.Second*1, true, cache.GetPolicyReturnExpired)
 				mock.tester.DeleteFromRedis(mock.key)
 				mock.tester.DeleteFromMem(mock.key)
 
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err := mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+
+				// the notification of Set is ignored by the writer
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.MemItem(mock.key)).ToNot(BeNil())
+
 				loadFunc := func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				}
+
+				var v TestStruct
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeSetRedis, cache.MetricTypeSetMem,
+					cache.MetricTypeSetCache, cache.MetricTypeGetMemHit, cache.MetricTypeGetCache}
+				for _, metricType := range metricList {
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
+				}
+			})
+
+			It("set illegal ttl", func() {
+				mock := newMockCache("set_illegal_ttl#1", time.Millisecond*1200, time.Second*1, false, cache.GetPolicyReturnExpired)
+				err := mock.ehCache.Set(context.Background(), mock.key, mock.val, time.Millisecond*1500)
+				Ω(errors.Is(err, cache.ErrIllegalTTL)).To(Equal(true))
+			})
+		})
+
+		Context("Test batch get", func() {
+			It("get objects ok", func() {
+				mock := newMockCache("get_objects_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				keys := []string{"get_objects_ok#1", "get_objects_ok#2", "get_objects_ok#3"}
+				for _, key := range keys {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				// first key is already in redis
+				err := mock.ehCache.Set(ctx, keys[0], &TestStruct{Name: keys[0]}, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+
+				var loadCalls int
+				var loadedKeys []string
+				loadFunc := func(missingKeys []string) (map[string]any, error) {
+					loadCalls++
+					loadedKeys = missingKeys
 					time.Sleep(mock.delay)
-					return mock.val, nil
+					objs := make(map[string]any)
+					for _, key := range missingKeys {
+						// the last key does not exist
+						if key == keys[2] {
+							continue
+						}
+						objs[key] = &TestStruct{Name: key}
+					}
+					return objs, nil
 				}
 
+				vs := make(map[string]*TestStruct)
+				err = mock.ehCache.GetObjects(ctx, keys, vs, time.Second*3, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(loadCalls).To(Equal(1))
+				Ω(loadedKeys).To(ConsistOf(keys[1], keys[2]))
+				Ω(vs).To(HaveLen(2))
+				Ω(vs[keys[0]]).To(Equal(&TestStruct{Name: keys[0]}))
+				Ω(vs[keys[1]]).To(Equal(&TestStruct{Name: keys[1]}))
+
+				// all found keys are cached now, loader is called for the missing one only
+				vs = make(map[string]*TestStruct)
+				err = mock.ehCache.GetObjects(ctx, keys, vs, time.Second*3, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(loadCalls).To(Equal(2))
+				Ω(loadedKeys).To(Equal([]string{keys[2]}))
+				Ω(vs).To(HaveLen(2))
+			})
+
+			It("get objects shares load with GetObject", func() {
+				mock := newMockCache("get_objects_shared#1", time.Millisecond*300, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 				defer cancel()
 
+				batchStarted := make(chan struct{})
+				batchDone := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(batchDone)
+					vs := make(map[string]TestStruct)
+					err := mock.ehCache.GetObjects(ctx, []string{mock.key}, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+						close(batchStarted)
+						time.Sleep(mock.delay)
+						return map[string]any{mock.key: mock.val}, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(vs[mock.key]).To(Equal(*mock.val))
+				}()
+
+				// wait batch load started
+				Eventually(batchStarted).Should(BeClosed())
+
 				var v TestStruct
-				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
 				Ω(err).ToNot(HaveOccurred())
 				Ω(&v).To(Equal(mock.val))
+				<-batchDone
+			})
 
-				// wait 1100 ms to expire mem
-				time.Sleep(time.Millisecond * 1100)
+			It("GetObject shares load with get objects", func() {
+				mock := newMockCache("get_objects_shared#2", time.Millisecond*300, time.Second*1, false, cache.GetPolicyReturnExpired)
+				other := "get_objects_shared#3"
+				for _, key := range []string{mock.key, other} {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
 
-				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 				defer cancel()
-				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*2, loadFunc)
+
+				loadStarted := make(chan struct{})
+				loadDone := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(loadDone)
+					var v TestStruct
+					err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+						close(loadStarted)
+						time.Sleep(mock.delay)
+						return mock.val, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(&v).To(Equal(mock.val))
+				}()
+
+				// wait single load started
+				Eventually(loadStarted).Should(BeClosed())
+
+				// the key being loaded is not passed to the batch loader, the batch waits for it
+				var batchKeys [][]string
+				vs := make(map[string]TestStruct)
+				err := mock.ehCache.GetObjects(ctx, []string{mock.key, other}, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					batchKeys = append(batchKeys, missingKeys)
+					return map[string]any{mock.key: &TestStruct{Name: "loaded twice"}, other: mock.val}, nil
+				})
 				Ω(err).ToNot(HaveOccurred())
-				Ω(&v).To(Equal(mock.val))
+				Ω(batchKeys).To(Equal([][]string{{other}}))
+				Ω(vs).To(Equal(map[string]TestStruct{mock.key: *mock.val, other: *mock.val}))
+				<-loadDone
 
-				// wait last async load finish
-				time.Sleep(mock.delay + time.Millisecond*10)
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Object).To(Equal(mock.val))
+			})
 
-				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
-					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeGetMemExpired,
-					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache,
-				}
-				for idx, metricType := range metricList {
-					select {
-					case mc := <-mock.metricChan:
-						Ω(mc.Key).To(Equal(mock.key))
-						Ω(mc.Type).To(Equal(metricType))
-						if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 12)) {
-							// the first get_cache should be same as delay
-							Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-						} else {
-							Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
-						}
-					default:
-					}
-				}
+			It("get objects illegal objs", func() {
+				mock := newMockCache("get_objects_illegal#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				var vs []TestStruct
+				err := mock.ehCache.GetObjects(context.Background(), []string{mock.key}, vs, time.Second*3, nil)
+				Ω(errors.Is(err, cache.ErrIllegalObjs)).To(Equal(true))
 			})
 		})
 
-		It("redis hit expired reload", func() {
-			mock := newMockCache("redis_hit_expired_reload#1", time.Millisecond*1200, time.Second, true, cache.GetPolicyReloadOnExpiry)
-			mock.tester.DeleteFromRedis(mock.key)
-			mock.tester.DeleteFromMem(mock.key)
+		Context("Test typed", func() {
+			It("typed get ok", func() {
+				mock := newMockCache("typed_get_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
 
-			loadFunc := func() (interface{}, error) {
-				time.Sleep(mock.delay)
-				return mock.val, nil
-			}
+				typed := cache.NewTyped[*TestStruct](mock.ehCache)
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
 
-			var v TestStruct
-			err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
-			Ω(err).ToNot(HaveOccurred())
-			Ω(&v).To(Equal(mock.val))
+				v, err := typed.Get(ctx, mock.key, time.Second*3, func(ctx context.Context) (*TestStruct, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(v).To(Equal(mock.val))
+				// returned value is a copy
+				Ω(v == mock.val).To(Equal(false))
 
-			// wait redis expired
-			time.Sleep(time.Millisecond * 1010)
-			mock.tester.DeleteFromMem(mock.key)
+				// read from redis
+				mock.tester.DeleteFromMem(mock.key)
+				v, err = typed.Get(ctx, mock.key, time.Second*3, func(ctx context.Context) (*TestStruct, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(v).To(Equal(mock.val))
 
-			ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
-			err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
-			Ω(err).ToNot(HaveOccurred())
-			Ω(&v).To(Equal(mock.val))
+				vs, err := typed.GetMany(ctx, []string{mock.key, "typed_get_ok#2"}, time.Second*3, func(ctx context.Context, missingKeys []string) (map[string]*TestStruct, error) {
+					return map[string]*TestStruct{}, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(Equal(map[string]*TestStruct{mock.key: mock.val}))
+			})
 
-			// make sure redis pub finished, mem get updated
-			time.Sleep(mock.delay + time.Millisecond*10)
+			It("typed interface panic", func() {
+				mock := newMockCache("typed_interface#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				Ω(func() { cache.NewTyped[any](mock.ehCache) }).To(Panic())
+			})
+		})
 
-			metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
-				cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss,
-				cache.MetricTypeGetRedisExpired, cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache,
-			}
+		Context("Test testing harness", func() {
+			It("inspect and expire", func() {
+				mock := newMockCache("testing_expire#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
 
-			for idx, metricType := range metricList {
-				select {
-				case mc := <-mock.metricChan:
-					Ω(mc.Key).To(Equal(mock.key))
-					Ω(mc.Type).To(Equal(metricType))
-					if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 14)) {
-						// the first get_cache should be same as delay
-						Ω(math.Abs(float64(mc.ElapsedTime-mock.delay)) < float64(time.Millisecond*10)).To(Equal(true))
-					} else {
-						Ω(math.Abs(float64(mc.ElapsedTime)) < float64(time.Millisecond*10)).To(Equal(true))
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				Ω(mock.tester.MemItem(mock.key)).To(BeNil())
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+
+				var v TestStruct
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				it = mock.tester.MemItem(mock.key)
+				Ω(it).ToNot(BeNil())
+				Ω(it.Expired()).To(Equal(false))
+				it, err = mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Object).To(Equal(mock.val))
+				Ω(it.Expired()).To(Equal(false))
+
+				err = mock.tester.Expire(mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.MemItem(mock.key).Expired()).To(Equal(true))
+				it, err = mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Expired()).To(Equal(true))
+				Ω(it.Object).To(Equal(mock.val))
+			})
+
+			It("sync pubsub and capture metrics", func() {
+				mock := newMockCache("testing_sync#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				// other has the key in mem before Set
+				other := newMockCache("testing_sync#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				var v TestStruct
+				err := other.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(other.tester.MemItem(mock.key)).ToNot(BeNil())
+
+				err = mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(other.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				// the notification of Set has been applied by other, the writer keeps its copy
+				Ω(other.tester.MemItem(mock.key)).To(BeNil())
+				Ω(mock.tester.MemItem(mock.key)).ToNot(BeNil())
+
+				mock.tester.ResetMetrics()
+				err = mock.ehCache.Delete(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				var types []string
+				for _, m := range mock.tester.Metrics() {
+					if m.Key == mock.key {
+						types = append(types, m.MetricType)
 					}
-				default:
 				}
-			}
+				Ω(types).To(ConsistOf(cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteCache, cache.MetricTypeDeleteMem))
+			})
 		})
 
-	})
-})
+		Context("Test close", func() {
+			It("close waits async load", func() {
+				mock := newMockCache("close_ok#1", time.Millisecond*300, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				// trigger an async load
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+				loaded := make(chan struct{})
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					time.Sleep(mock.delay)
+					close(loaded)
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock.ehCache.Close(ctx)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(loaded).To(BeClosed())
+
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, nil)
+				Ω(errors.Is(err, cache.ErrClosed)).To(Equal(true))
+				err = mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3)
+				Ω(errors.Is(err, cache.ErrClosed)).To(Equal(true))
+				err = mock.ehCache.Delete(ctx, mock.key)
+				Ω(errors.Is(err, cache.ErrClosed)).To(Equal(true))
+				err = mock.ehCache.Close(ctx)
+				Ω(errors.Is(err, cache.ErrClosed)).To(Equal(true))
+			})
+		})
+
+		Context("Test delete by tag", func() {
+			It("delete by tag ok", func() {
+				mock := newMockCache("delete_tag_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				keys := []string{"delete_tag_ok#1", "delete_tag_ok#2", "delete_tag_ok#3"}
+				for _, key := range keys {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				loadFunc := func() (interface{}, error) {
+					return mock.val, nil
+				}
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, keys[0], &v, time.Second*3, loadFunc, cache.Tags("user#1"))
+				Ω(err).ToNot(HaveOccurred())
+				err = mock.ehCache.Set(ctx, keys[1], mock.val, time.Second*3, cache.Tags("user#1", "user#2"))
+				Ω(err).ToNot(HaveOccurred())
+				err = mock.ehCache.GetObject(ctx, keys[2], &v, time.Second*3, loadFunc, cache.Tags("user#2"))
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock.ehCache.DeleteByTag(ctx, "user#1")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				for _, key := range keys[:2] {
+					Ω(mock.tester.MemItem(key)).To(BeNil())
+					it, err := mock.tester.RedisItem(key, &TestStruct{})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(it).To(BeNil())
+				}
+				Ω(mock.tester.MemItem(keys[2])).ToNot(BeNil())
+
+				// deleting an empty tag is a no-op
+				err = mock.ehCache.DeleteByTag(ctx, "user#1")
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock.ehCache.DeleteByTag(ctx, "user#2")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.MemItem(keys[2])).To(BeNil())
+			})
+
+			It("expired keys pruned from tag", func() {
+				mock := newMockCache("tag_prune#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				_, err = conn.Do("DEL", "default:tag:prune#1")
+				Ω(err).ToNot(HaveOccurred())
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err = mock.ehCache.Set(ctx, "tag_prune#1", mock.val, time.Second*3, cache.Tags("prune#1"))
+				Ω(err).ToNot(HaveOccurred())
+				// like expired in redis
+				Ω(mock.tester.DeleteFromRedis("tag_prune#1")).ToNot(HaveOccurred())
+
+				err = mock.ehCache.Set(ctx, "tag_prune#2", mock.val, time.Second*3, cache.Tags("prune#1"))
+				Ω(err).ToNot(HaveOccurred())
+
+				members, err := redis.Strings(conn.Do("SMEMBERS", "default:tag:prune#1"))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(members).To(Equal([]string{"default:tag_prune#2"}))
+			})
+
+			It("tag failure reported", func() {
+				var tagErrs atomic.Int32
+				mock := newMockCache("tag_failure#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.OnError(func(ctx context.Context, err error) {
+						tagErrs.Add(1)
+					}))
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				// not a set
+				_, err = conn.Do("SET", "default:tag:failure#1", "x")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Do("DEL", "default:tag:failure#1")
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				// the object is cached anyway
+				err = mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3, cache.Tags("failure#1"))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(tagErrs.Load()).To(Equal(int32(1)))
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).ToNot(BeNil())
+			})
+		})
+
+		Context("Test delete object type", func() {
+			It("delete object type ok", func() {
+				mock := newMockCache("delete_type_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+
+				// a thousand of keys are set one by one, which is slow with -race
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+				defer cancel()
+
+				var keys []string
+				for i := 0; i < 1200; i++ {
+					keys = append(keys, fmt.Sprintf("delete_type_ok#%d", i))
+				}
+				// same prefix but different object type
+				other := "delete_type_ok_other#1"
+				for _, key := range append(keys, other) {
+					err := mock.ehCache.Set(ctx, key, mock.val, time.Second*3)
+					Ω(err).ToNot(HaveOccurred())
+				}
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				// warm up mem
+				vs := make(map[string]*TestStruct)
+				err := mock.ehCache.GetObjects(ctx, append(keys, other), vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(HaveLen(len(keys) + 1))
+
+				err = mock.ehCache.DeleteObjectType(ctx, "delete_type_ok")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				for _, key := range keys {
+					Ω(mock.tester.MemItem(key)).To(BeNil())
+					it, err := mock.tester.RedisItem(key, &TestStruct{})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(it).To(BeNil())
+				}
+				Ω(mock.tester.MemItem(other)).ToNot(BeNil())
+				it, err := mock.tester.RedisItem(other, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).ToNot(BeNil())
+			})
+		})
+
+		Context("Test context-aware loader", func() {
+			It("loader ctx", func() {
+				mock := newMockCache("loader_ctx#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				type ctxKey struct{}
+				ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "trace"), time.Second*5)
+
+				var v TestStruct
+				err := mock.ehCache.GetObjectCtx(ctx, mock.key, &v, time.Second*3, func(loadCtx context.Context) (interface{}, error) {
+					// synchronous load gets the caller ctx
+					Ω(loadCtx).To(Equal(ctx))
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				// async load after expiry, caller ctx is canceled right after return
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+				loadCtxs := make(chan context.Context, 1)
+				err = mock.ehCache.GetObjectCtx(ctx, mock.key, &v, time.Second*3, func(loadCtx context.Context) (interface{}, error) {
+					time.Sleep(mock.delay)
+					loadCtxs <- loadCtx
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				cancel()
+
+				var loadCtx context.Context
+				Eventually(loadCtxs).Should(Receive(&loadCtx))
+				Ω(loadCtx.Err()).ToNot(HaveOccurred())
+				Ω(loadCtx.Value(ctxKey{})).To(Equal("trace"))
+			})
+		})
+
+		Context("Test negative cache", func() {
+			It("not found ok", func() {
+				mock := newMockCache("not_found_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var loadCalls int
+				loadFunc := func() (interface{}, error) {
+					loadCalls++
+					return nil, cache.ErrNotFound
+				}
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc, cache.NotFoundTTL(time.Second))
+				Ω(errors.Is(err, cache.ErrNotFound)).To(Equal(true))
+				Ω(loadCalls).To(Equal(1))
+
+				it := mock.tester.MemItem(mock.key)
+				Ω(it.NotFound).To(Equal(true))
+				Ω(it.ExpireAt - time.Now().UnixMilli()).To(BeNumerically("<=", 1000))
+				it, err = mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.NotFound).To(Equal(true))
+				Ω(it.Object).To(BeNil())
+
+				// tombstone hit in mem, then in redis
+				mock.tester.ResetMetrics()
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc)
+				Ω(errors.Is(err, cache.ErrNotFound)).To(Equal(true))
+				mock.tester.DeleteFromMem(mock.key)
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc)
+				Ω(errors.Is(err, cache.ErrNotFound)).To(Equal(true))
+				Ω(loadCalls).To(Equal(1))
+
+				var types []string
+				for _, m := range mock.tester.Metrics() {
+					if m.Key == mock.key {
+						types = append(types, m.MetricType)
+					}
+				}
+				Ω(types).To(ContainElements(cache.MetricTypeGetMemNotFound, cache.MetricTypeGetRedisNotFound))
+
+				// batch get skips tombstones
+				vs := make(map[string]*TestStruct)
+				err = mock.ehCache.GetObjects(ctx, []string{mock.key, "not_found_ok#2"}, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					return map[string]any{"not_found_ok#2": cache.ErrNotFound}, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(BeEmpty())
+				Ω(mock.tester.MemItem("not_found_ok#2").NotFound).To(Equal(true))
+				mock.tester.DeleteFromRedis("not_found_ok#2")
+			})
+		})
+
+		Context("Test stale if error", func() {
+			It("stale if error ok", func() {
+				var onErrors atomic.Int32
+				mock := newMockCache("stale_if_error#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReloadOnExpiry,
+					cache.OnError(func(ctx context.Context, err error) {
+						onErrors.Add(1)
+					}))
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+
+				loadErr := errors.New("db down")
+				failFunc := func() (interface{}, error) {
+					return nil, loadErr
+				}
+				panicFunc := func() (interface{}, error) {
+					panic("db down")
+				}
+
+				// no stale data without option
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, failFunc)
+				Ω(err).To(Equal(loadErr))
+
+				mock.tester.ResetMetrics()
+				v = TestStruct{}
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, failFunc, cache.StaleIfError(time.Minute))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				v = TestStruct{}
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, panicFunc, cache.StaleIfError(time.Minute))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				var staleCount int
+				for _, m := range mock.tester.Metrics() {
+					if m.Key == mock.key && m.MetricType == cache.MetricTypeStaleIfError {
+						staleCount++
+					}
+				}
+				Ω(staleCount).To(Equal(2))
+				// a panic is reported once
+				Ω(onErrors.Load()).To(Equal(int32(2)))
+
+				// expired for too long
+				Eventually(func() error {
+					return mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, failFunc, cache.StaleIfError(time.Millisecond*10))
+				}).Should(Equal(loadErr))
+			})
+		})
+
+		Context("Test early refresh", func() {
+			It("early refresh ok", func() {
+				mock := newMockCache("early_refresh#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				loadCalls := make(chan struct{}, 10)
+				loadFunc := func() (interface{}, error) {
+					time.Sleep(mock.delay)
+					loadCalls <- struct{}{}
+					return mock.val, nil
+				}
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(loadCalls).To(Receive())
+				Ω(mock.tester.MemItem(mock.key).Delta).To(BeNumerically(">=", mock.delay.Milliseconds()))
+
+				// no refresh by default
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Consistently(loadCalls, mock.delay*2).ShouldNot(Receive())
+
+				// a huge beta makes refresh almost certain
+				mock.tester.ResetMetrics()
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, loadFunc, cache.EarlyRefresh(1e6))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+				Eventually(loadCalls).Should(Receive())
+
+				var types []string
+				for _, m := range mock.tester.Metrics() {
+					if m.Key == mock.key {
+						types = append(types, m.MetricType)
+					}
+				}
+				Ω(types).To(ContainElements(cache.MetricTypeGetMemHit, cache.MetricTypeEarlyRefresh))
+			})
+		})
+
+		Context("Test ttl jitter", func() {
+			It("ttl jitter ok", func() {
+				mock := newMockCache("ttl_jitter#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+
+				keys := make([]string, 20)
+				for i := range keys {
+					keys[i] = fmt.Sprintf("ttl_jitter#%d", i)
+					mock.tester.DeleteFromRedis(keys[i])
+					mock.tester.DeleteFromMem(keys[i])
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				objs := make(map[string]*TestStruct)
+				start := time.Now()
+				err := mock.ehCache.GetObjects(ctx, keys, objs, time.Second*10, func(missingKeys []string) (map[string]any, error) {
+					vs := make(map[string]any, len(missingKeys))
+					for _, key := range missingKeys {
+						vs[key] = &TestStruct{Name: "value for" + key}
+					}
+					return vs, nil
+				}, cache.TTLJitter(0.5))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(objs).To(HaveLen(len(keys)))
+
+				expireAts := make(map[int64]bool)
+				for _, key := range keys {
+					it := mock.tester.MemItem(key)
+					Ω(it.ExpireAt).To(BeNumerically(">=", start.Add(time.Second*5).UnixMilli()))
+					Ω(it.ExpireAt).To(BeNumerically("<=", time.Now().Add(time.Second*15).UnixMilli()))
+					expireAts[it.ExpireAt] = true
+
+					rit, err := mock.tester.RedisItem(key, &TestStruct{})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(rit.ExpireAt).To(Equal(it.ExpireAt))
+				}
+				// objects loaded together do not expire together
+				Ω(len(expireAts)).To(BeNumerically(">", 1))
+			})
+
+			It("rand seed ok", func() {
+				// jittered ttl of keys set one by one, in ms, within [min, max] as ExpireAt is now+ttl
+				jittered := func(mock mockCache, prefix string) (mins, maxs []int64) {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+					defer cancel()
+
+					for i := 0; i < 5; i++ {
+						key := fmt.Sprintf("%s#%d", prefix, i)
+						before := time.Now().UnixMilli()
+						err := mock.ehCache.Set(ctx, key, mock.val, time.Second*10, cache.TTLJitter(0.5))
+						Ω(err).ToNot(HaveOccurred())
+						after := time.Now().UnixMilli()
+
+						expireAt := mock.tester.MemItem(key).ExpireAt
+						// ttl is not in whole ms, 1ms off once truncated
+						mins = append(mins, expireAt-after-1)
+						maxs = append(maxs, expireAt-before+1)
+					}
+					return
+				}
+
+				mock1 := newMockCache("rand_seed_1#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.RandSeed(42))
+				mock2 := newMockCache("rand_seed_2#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.RandSeed(42))
+				mins1, maxs1 := jittered(mock1, "rand_seed_1")
+				mins2, maxs2 := jittered(mock2, "rand_seed_2")
+
+				// same seed, same jitter
+				for i := range mins1 {
+					Ω(mins1[i]).To(BeNumerically("<=", maxs2[i]))
+					Ω(mins2[i]).To(BeNumerically("<=", maxs1[i]))
+				}
+				// still jittered from one key to another
+				Ω(mins1).ToNot(HaveEach(mins1[0]))
+			})
+		})
+
+		Context("Test load lock", func() {
+			metricTypes := func(tester *cache.Testing, key string) []string {
+				var types []string
+				for _, m := range tester.Metrics() {
+					if m.Key == key {
+						types = append(types, m.MetricType)
+					}
+				}
+				return types
+			}
+
+			It("load lock wait ok", func() {
+				mock1 := newMockCache("load_lock_wait#1", time.Millisecond*300, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock2 := newMockCache("load_lock_wait#1", time.Millisecond*300, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock1.tester.DeleteFromRedis(mock1.key)
+				mock1.tester.DeleteFromMem(mock1.key)
+				mock2.tester.DeleteFromMem(mock2.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				done := make(chan error, 1)
+				go func() {
+					var v TestStruct
+					done <- mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+						time.Sleep(mock1.delay)
+						return mock1.val, nil
+					}, cache.LoadLock(time.Second*2))
+				}()
+				// wait mock1 acquired the lock
+				Eventually(func() []string {
+					return metricTypes(mock1.tester, mock1.key)
+				}).Should(ContainElement(cache.MetricTypeLockAcquired))
+
+				var v TestStruct
+				err := mock2.ehCache.GetObject(ctx, mock2.key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader of mock2 should not be called")
+				}, cache.LoadLock(time.Second*2))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock1.val))
+				Ω(<-done).ToNot(HaveOccurred())
+
+				Ω(metricTypes(mock1.tester, mock1.key)).To(ContainElements(cache.MetricTypeLockAcquired, cache.MetricTypeLoad))
+				Ω(metricTypes(mock2.tester, mock2.key)).To(ContainElement(cache.MetricTypeLockWait))
+				Ω(metricTypes(mock2.tester, mock2.key)).ToNot(ContainElement(cache.MetricTypeLoad))
+
+				// loaded by mock1, now cached in mem of mock2
+				Ω(mock2.tester.MemItem(mock2.key)).ToNot(BeNil())
+			})
+
+			It("load lock timeout ok", func() {
+				mock1 := newMockCache("load_lock_timeout#1", time.Millisecond*600, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock2 := newMockCache("load_lock_timeout#1", time.Millisecond*600, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock1.tester.DeleteFromRedis(mock1.key)
+				mock1.tester.DeleteFromMem(mock1.key)
+				mock2.tester.DeleteFromMem(mock2.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				done := make(chan error, 1)
+				go func() {
+					var v TestStruct
+					done <- mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+						time.Sleep(mock1.delay)
+						return mock1.val, nil
+					}, cache.LoadLock(time.Second*2))
+				}()
+				// wait mock1 acquired the lock
+				Eventually(func() []string {
+					return metricTypes(mock1.tester, mock1.key)
+				}).Should(ContainElement(cache.MetricTypeLockAcquired))
+
+				// nothing to fall back to, mock2 calls its own loader once lock wait times out
+				var v TestStruct
+				err := mock2.ehCache.GetObject(ctx, mock2.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock2.val, nil
+				}, cache.LoadLock(time.Millisecond*200))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock2.val))
+				Ω(<-done).ToNot(HaveOccurred())
+
+				Ω(metricTypes(mock2.tester, mock2.key)).To(ContainElements(cache.MetricTypeLockTimeout, cache.MetricTypeLoad))
+			})
+		})
+
+		Context("Test update policy", func() {
+			setup := func(key string) (mock1, mock2 mockCache, ctx context.Context, cancel context.CancelFunc) {
+				mock1 = newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock2 = newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock1.tester.DeleteFromRedis(key)
+				mock1.tester.DeleteFromMem(key)
+				mock2.tester.DeleteFromMem(key)
+
+				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+
+				// both instances have the key cached in mem
+				var v TestStruct
+				err := mock1.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return mock1.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				err = mock2.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader of mock2 should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock2.tester.MemItem(key)).ToNot(BeNil())
+
+				// force mock1 to reload
+				mock1.tester.DeleteFromMem(key)
+				mock1.tester.DeleteFromRedis(key)
+				return
+			}
+
+			It("update policy broadcast ok", func() {
+				mock1, mock2, ctx, cancel := setup("update_broadcast#1")
+				defer cancel()
+
+				newVal := &TestStruct{Name: "new value"}
+				var v TestStruct
+				err := mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+					return newVal, nil
+				}, cache.UpdatePolicy(cache.UpdatePolicyBroadcast))
+				Ω(err).ToNot(HaveOccurred())
+
+				Ω(mock1.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				// peer dropped its stale copy, the reloading instance keeps its own
+				Ω(mock2.tester.MemItem(mock2.key)).To(BeNil())
+				Ω(mock1.tester.MemItem(mock1.key).Object).To(Equal(newVal))
+			})
+
+			It("update policy broadcast reload ok", func() {
+				mock1, mock2, ctx, cancel := setup("update_broadcast_reload#1")
+				defer cancel()
+
+				newVal := &TestStruct{Name: "new value"}
+				var v TestStruct
+				err := mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+					return newVal, nil
+				}, cache.UpdatePolicy(cache.UpdatePolicyBroadcastReload))
+				Ω(err).ToNot(HaveOccurred())
+
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				// peer re-read the new value from redis, asynchronously
+				Eventually(func() any {
+					return mock2.tester.MemItem(mock2.key).Object
+				}).Should(Equal(newVal))
+			})
+
+			It("update policy no broadcast ok", func() {
+				mock1, mock2, ctx, cancel := setup("update_no_broadcast#1")
+				defer cancel()
+
+				var v TestStruct
+				err := mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+					return &TestStruct{Name: "new value"}, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock2.tester.MemItem(mock2.key).Object).To(Equal(mock2.val))
+			})
+		})
+
+		Context("Test inspection", func() {
+			It("peek and inspect ok", func() {
+				mock := newMockCache("inspect_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				// nothing cached
+				var v TestStruct
+				err := mock.ehCache.Peek(ctx, mock.key, &v)
+				Ω(errors.Is(err, cache.ErrCacheMiss)).To(Equal(true))
+				info, err := mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(*info).To(Equal(cache.Info{}))
+
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				mock.tester.ResetMetrics()
+				info, err = mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InMem).To(Equal(true))
+				Ω(info.InRedis).To(Equal(true))
+				Ω(info.Expired).To(Equal(false))
+
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+				size, err := redis.Int(conn.Do("STRLEN", "default:"+mock.key))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.Size).To(Equal(size))
+				Ω(time.Until(info.ExpireAt)).To(BeNumerically("~", time.Second*3, time.Millisecond*500))
+				// redis ttl = ttl*RedisTTLFactor
+				Ω(info.RedisTTL).To(BeNumerically("~", time.Second*12, time.Millisecond*500))
+
+				// peek from redis only, mem is not populated
+				mock.tester.DeleteFromMem(mock.key)
+				var peeked TestStruct
+				err = mock.ehCache.Peek(ctx, mock.key, &peeked)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&peeked).To(Equal(mock.val))
+				Ω(mock.tester.MemItem(mock.key)).To(BeNil())
+
+				// read-only inspection has no get metric
+				for _, m := range mock.tester.Metrics() {
+					Ω(m.MetricType).ToNot(HavePrefix("get_"))
+				}
+
+				// expired objects are peeked as well
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+				err = mock.ehCache.Peek(ctx, mock.key, &peeked)
+				Ω(err).ToNot(HaveOccurred())
+				info, err = mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InMem).To(Equal(false))
+				Ω(info.InRedis).To(Equal(true))
+				Ω(info.Expired).To(Equal(true))
+			})
+
+			It("peek tombstone ok", func() {
+				mock := newMockCache("inspect_tombstone#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, cache.ErrNotFound
+				})
+				Ω(errors.Is(err, cache.ErrNotFound)).To(Equal(true))
+
+				err = mock.ehCache.Peek(ctx, mock.key, &v)
+				Ω(errors.Is(err, cache.ErrNotFound)).To(Equal(true))
+				info, err := mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.NotFound).To(Equal(true))
+			})
+		})
+
+		Context("Test touch", func() {
+			It("touch ok", func() {
+				mock := newMockCache("touch_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err := mock.ehCache.Touch(ctx, mock.key, time.Second*10)
+				Ω(errors.Is(err, cache.ErrCacheMiss)).To(Equal(true))
+
+				var v TestStruct
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock.ehCache.Touch(ctx, mock.key, time.Second*10)
+				Ω(err).ToNot(HaveOccurred())
+
+				info, err := mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(time.Until(info.ExpireAt)).To(BeNumerically("~", time.Second*10, time.Millisecond*500))
+				Ω(info.RedisTTL).To(BeNumerically("~", time.Second*40, time.Millisecond*500))
+
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.ExpireAt).To(Equal(info.ExpireAt.UnixMilli()))
+				Ω(it.Object).To(Equal(mock.val))
+			})
+
+			It("touch ttl of object type ok", func() {
+				mock := newMockCache("touch_type_ttl#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.ObjectType("touch_type_ttl", cache.ObjectTypeConfig{TTL: time.Second * 20}))
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock.ehCache.Touch(ctx, mock.key, -time.Second)
+				Ω(errors.Is(err, cache.ErrIllegalTTL)).To(Equal(true))
+
+				// 0 ttl is the ttl of the object type
+				err = mock.ehCache.Touch(ctx, mock.key, 0)
+				Ω(err).ToNot(HaveOccurred())
+
+				info, err := mock.ehCache.Inspect(ctx, mock.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(time.Until(info.ExpireAt)).To(BeNumerically("~", time.Second*20, time.Millisecond*500))
+				Ω(info.RedisTTL).To(BeNumerically("~", time.Second*80, time.Millisecond*500))
+			})
+
+			It("touch legacy envelope ok", func() {
+				mock := newMockCache("touch_legacy#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromMem(mock.key)
+
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				// expire_at after the object, which has a field named expire_at as well
+				_, err = conn.Do("SET", "default:"+mock.key, `{"object":{"Name":"legacy","expire_at":1},"size":0,"expire_at":1}`)
+				Ω(err).ToNot(HaveOccurred())
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err = mock.ehCache.Touch(ctx, mock.key, time.Second*10)
+				Ω(err).ToNot(HaveOccurred())
+
+				body, err := redis.String(conn.Do("GET", "default:"+mock.key))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(body).To(HavePrefix(`{"object":{"Name":"legacy","expire_at":1},"size":0,"expire_at":`))
+
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Expired()).To(Equal(false))
+				Ω(it.Object).To(Equal(&TestStruct{Name: "legacy"}))
+			})
+
+			It("sliding expiration ok", func() {
+				mock := newMockCache("sliding_ok#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				loadFunc := func() (interface{}, error) {
+					return mock.val, nil
+				}
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*2, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+
+				// a hit pushes expiration forward without reloading
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*10, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				}, cache.SlidingExpiration(true))
+				Ω(err).ToNot(HaveOccurred())
+
+				Eventually(func() int64 {
+					return mock.tester.MemItem(mock.key).ExpireAt - time.Now().UnixMilli()
+				}).Should(BeNumerically(">", 9000))
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.ExpireAt).To(Equal(mock.tester.MemItem(mock.key).ExpireAt))
+			})
+		})
+
+		Context("Test bounded mem", func() {
+			It("lru eviction ok", func() {
+				mock := newMockCache("lru_evict#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.MaxMemEntries(2))
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				get := func(key string) {
+					var v TestStruct
+					err := mock.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return &TestStruct{Name: "value for" + key}, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+				}
+
+				keys := []string{"lru_evict#1", "lru_evict#2", "lru_evict#3"}
+				for _, key := range keys {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
+
+				get(keys[0])
+				get(keys[1])
+				// keys[0] becomes the most recently used
+				get(keys[0])
+				get(keys[2])
+
+				Ω(mock.tester.MemItem(keys[0])).ToNot(BeNil())
+				Ω(mock.tester.MemItem(keys[1])).To(BeNil())
+				Ω(mock.tester.MemItem(keys[2])).ToNot(BeNil())
+
+				// evicted from mem only, still in redis
+				it, err := mock.tester.RedisItem(keys[1], &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).ToNot(BeNil())
+
+				// evictions are reported with count and mem_usage by the janitor
+				Eventually(func() []cache.MetricRecord {
+					var evictions []cache.MetricRecord
+					for _, m := range mock.tester.Metrics() {
+						if m.MetricType == cache.MetricTypeEviction && m.ObjectType == "lru_evict" {
+							evictions = append(evictions, m)
+						}
+					}
+					return evictions
+				}, time.Second*3).Should(ContainElement(HaveField("Count", 1)))
+			})
+		})
+
+		Context("Test size", func() {
+			It("size from encoding ok", func() {
+				mock := newMockCache("size_encoding#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				// loaded and read from redis have the same size
+				it, err := mock.tester.RedisItem(mock.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.MemItem(mock.key).Size).To(BeNumerically(">", 0))
+				Ω(mock.tester.MemItem(mock.key).Size).To(Equal(it.Size))
+			})
+
+			It("size from sizer ok", func() {
+				mock := newMockCache("size_sizer#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.MaxMemBytes(1500))
+				keys := []string{"size_sizer#1", "size_sizer#2"}
+				for _, key := range keys {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				for _, key := range keys {
+					var v SizedStruct
+					err := mock.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return &SizedStruct{Name: key}, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+				}
+
+				// the first one is evicted to keep mem below 1500 bytes
+				Ω(mock.tester.MemItem(keys[0])).To(BeNil())
+				Ω(mock.tester.MemItem(keys[1]).Size).To(Equal(1000))
+
+				it, err := mock.tester.RedisItem(keys[0], &SizedStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Size).To(Equal(1000))
+			})
+		})
+
+		Context("Test object type config", func() {
+			It("object type config ok", func() {
+				mock := newMockCache("type_cfg#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.ObjectType("type_cfg", cache.ObjectTypeConfig{
+						TTL:            time.Second * 5,
+						RedisTTLFactor: 2,
+						GetPolicy:      cache.GetPolicyReloadOnExpiry,
+					}),
+					cache.ObjectType("type_cfg_no_mem", cache.ObjectTypeConfig{
+						DisableMem: true,
+					}),
+					cache.ObjectType("type_cfg_small", cache.ObjectTypeConfig{
+						MaxMemSize: 10,
+					}),
+				)
+				keys := []string{"type_cfg#1", "type_cfg_no_mem#1", "type_cfg_small#1"}
+				for _, key := range keys {
+					mock.tester.DeleteFromRedis(key)
+					mock.tester.DeleteFromMem(key)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				for _, key := range keys {
+					err := mock.ehCache.GetObject(ctx, key, &v, 0, func() (interface{}, error) {
+						return &TestStruct{Name: "value for" + key}, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+				}
+
+				// ttl and redis ttl factor of object type
+				info, err := mock.ehCache.Inspect(ctx, keys[0])
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InMem).To(Equal(true))
+				Ω(time.Until(info.ExpireAt)).To(BeNumerically("~", time.Second*5, time.Millisecond*500))
+				Ω(info.RedisTTL).To(BeNumerically("~", time.Second*10, time.Millisecond*500))
+
+				// get policy of object type, expired object is reloaded before return
+				Ω(mock.tester.Expire(keys[0])).ToNot(HaveOccurred())
+				err = mock.ehCache.GetObject(ctx, keys[0], &v, 0, func() (interface{}, error) {
+					return &TestStruct{Name: "new value"}, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(v.Name).To(Equal("new value"))
+
+				// not cached in-memory, no expiration with global options
+				info, err = mock.ehCache.Inspect(ctx, keys[1])
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InMem).To(Equal(false))
+				Ω(info.InRedis).To(Equal(true))
+				Ω(info.ExpireAt.IsZero()).To(Equal(true))
+				Ω(info.RedisTTL).To(Equal(time.Duration(-1)))
+
+				err = mock.ehCache.GetObject(ctx, keys[1], &v, 0, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock.tester.MemItem(keys[1])).To(BeNil())
+
+				// larger than MaxMemSize
+				Ω(mock.tester.MemItem(keys[2])).To(BeNil())
+			})
+		})
+
+		Context("Test codec", func() {
+			It("codec migration ok", func() {
+				for _, codec := range []cache.Codec{cache.MsgpackCodec{}, cache.GobCodec{}, cache.JSONCodec{}} {
+					key := "codec_" + codec.ID() + "#1"
+					writer := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Encoding(codec))
+					// reader is still on the default codec
+					reader := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+					writer.tester.DeleteFromRedis(key)
+					writer.tester.DeleteFromMem(key)
+					reader.tester.DeleteFromMem(key)
+
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+					var v TestStruct
+					err := writer.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return writer.val, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+
+					err = reader.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return nil, errors.New("loader should not be called")
+					})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(&v).To(Equal(writer.val))
+					cancel()
+				}
+			})
+
+			It("proto codec ok", func() {
+				mock := newMockCache("codec_proto#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Encoding(cache.ProtoCodec{}))
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v wrapperspb.StringValue
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return wrapperspb.String("proto value"), nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(v.GetValue()).To(Equal("proto value"))
+
+				it, err := mock.tester.RedisItem(mock.key, &wrapperspb.StringValue{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Object.(*wrapperspb.StringValue).GetValue()).To(Equal("proto value"))
+
+				// objects which are not proto.Message can't be written
+				err = mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3)
+				Ω(err).To(HaveOccurred())
+			})
+		})
+
+		Context("Test compression", func() {
+			It("compression ok", func() {
+				for _, compressor := range []cache.Compressor{cache.GzipCompressor{}, cache.DeflateCompressor{Level: 9}} {
+					key := "compression_" + compressor.ID() + "#1"
+					writer := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Compression(compressor, 100))
+					// reader has no compression configured
+					reader := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired)
+					writer.tester.DeleteFromRedis(key)
+					writer.tester.DeleteFromMem(key)
+					reader.tester.DeleteFromMem(key)
+
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+					large := &TestStruct{Name: strings.Repeat("compressible ", 100)}
+					var v TestStruct
+					err := writer.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return large, nil
+					})
+					Ω(err).ToNot(HaveOccurred())
+
+					err = reader.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+						return nil, errors.New("loader should not be called")
+					})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(&v).To(Equal(large))
+
+					sizes := make(map[string]int)
+					for _, m := range writer.tester.Metrics() {
+						if m.MetricType == cache.MetricTypeRawSize || m.MetricType == cache.MetricTypeCompressedSize {
+							sizes[m.MetricType] = m.Count
+						}
+					}
+					Ω(sizes[cache.MetricTypeRawSize]).To(BeNumerically(">", 1300))
+					Ω(sizes[cache.MetricTypeCompressedSize]).To(BeNumerically("<", sizes[cache.MetricTypeRawSize]/10))
+
+					// the compressed payload follows the envelope as is
+					conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+					Ω(err).ToNot(HaveOccurred())
+					body, err := redis.Bytes(conn.Do("GET", "default:"+key))
+					Ω(err).ToNot(HaveOccurred())
+					conn.Close()
+					_, payload, found := bytes.Cut(body, []byte("\n"))
+					Ω(found).To(BeTrue())
+					Ω(payload).To(HaveLen(sizes[cache.MetricTypeCompressedSize]))
+
+					// in-memory sizes are raw sizes, whether written or read
+					Ω(writer.tester.MemItem(key).Size).To(Equal(sizes[cache.MetricTypeRawSize]))
+					Ω(reader.tester.MemItem(key).Size).To(Equal(sizes[cache.MetricTypeRawSize]))
+					cancel()
+				}
+			})
+
+			It("below threshold not compressed", func() {
+				mock := newMockCache("compression_threshold#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Compression(cache.GzipCompressor{}, 1024))
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err := mock.ehCache.Set(ctx, mock.key, mock.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+
+				var v TestStruct
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				for _, m := range mock.tester.Metrics() {
+					Ω(m.MetricType).ToNot(Equal(cache.MetricTypeCompressedSize))
+				}
+			})
+		})
+
+		Context("Test encryption", func() {
+			k1 := []byte("0123456789abcdef0123456789abcdef")
+			k2 := []byte("fedcba9876543210fedcba9876543210")
+
+			It("encryption with key rotation ok", func() {
+				key := "encryption_rotation#1"
+				writer := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.Encryption(cache.StaticKeyProvider{Current: "k1", Keys: map[string][]byte{"k1": k1}}))
+				// reader has rotated to k2, k1 is kept to decrypt existing objects
+				reader := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.Encryption(cache.StaticKeyProvider{Current: "k2", Keys: map[string][]byte{"k1": k1, "k2": k2}}))
+				writer.tester.DeleteFromRedis(key)
+				writer.tester.DeleteFromMem(key)
+				reader.tester.DeleteFromMem(key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := writer.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return writer.val, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				body, err := redis.String(conn.Do("GET", "default:"+key))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(body).To(ContainSubstring(`"kid":"k1"`))
+				Ω(body).ToNot(ContainSubstring(writer.val.Name))
+
+				err = reader.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(writer.val))
+			})
+
+			It("decryption failure is a miss", func() {
+				key := "encryption_failure#1"
+				writer := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.Encryption(cache.StaticKeyProvider{Current: "k1", Keys: map[string][]byte{"k1": k1}}))
+				var decryptErrs atomic.Int32
+				reader := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.Encryption(cache.StaticKeyProvider{Current: "k2", Keys: map[string][]byte{"k2": k2}}),
+					cache.OnError(func(ctx context.Context, err error) {
+						if errors.Is(err, cache.ErrDecrypt) {
+							decryptErrs.Add(1)
+						}
+					}))
+				writer.tester.DeleteFromRedis(key)
+				writer.tester.DeleteFromMem(key)
+				reader.tester.DeleteFromMem(key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err := writer.ehCache.Set(ctx, key, writer.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+
+				// k1 is unknown to reader, the object is reloaded and encrypted with k2
+				var v TestStruct
+				err = reader.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return &TestStruct{Name: "reloaded"}, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(v.Name).To(Equal("reloaded"))
+				Ω(decryptErrs.Load()).To(BeNumerically(">=", 1))
+
+				it, err := reader.tester.RedisItem(key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.Object).To(Equal(&TestStruct{Name: "reloaded"}))
+			})
+		})
+
+		Context("Test remote store", func() {
+			It("in-process store ok", func() {
+				store := cache.NewInProcessStore()
+				// instances sharing the store like instances sharing a redis
+				mock1 := newMockCache("inprocess_store#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Store(store))
+				mock2 := newMockCache("inprocess_store#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Store(store))
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock1.ehCache.GetObject(ctx, mock1.key, &v, time.Second*3, func() (interface{}, error) {
+					return mock1.val, nil
+				}, cache.Tags("inprocess#1"))
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock2.ehCache.GetObject(ctx, mock2.key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock1.val))
+
+				info, err := mock2.ehCache.Inspect(ctx, mock2.key)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InRedis).To(BeTrue())
+				Ω(info.RedisTTL).To(BeNumerically(">", time.Second*3))
+
+				err = mock1.ehCache.Touch(ctx, mock1.key, time.Second*10)
+				Ω(err).ToNot(HaveOccurred())
+				it, err := mock2.tester.RedisItem(mock2.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.ExpireAt).To(BeNumerically(">", time.Now().Add(time.Second*9).UnixMilli()))
+
+				// deletion is broadcast to the other instance
+				err = mock1.ehCache.DeleteByTag(ctx, "inprocess#1")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock2.tester.MemItem(mock2.key)).To(BeNil())
+				it, err = mock2.tester.RedisItem(mock2.key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+
+				err = mock1.ehCache.Set(ctx, "inprocess_store#2", mock1.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+				err = mock2.ehCache.Peek(ctx, "inprocess_store#2", &v)
+				Ω(err).ToNot(HaveOccurred())
+
+				err = mock1.ehCache.DeleteObjectType(ctx, "inprocess_store")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock2.tester.MemItem("inprocess_store#2")).To(BeNil())
+				it, err = mock2.tester.RedisItem("inprocess_store#2", &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+			})
+
+			It("store without optional capabilities ok", func() {
+				store := coreStore{RemoteStore: cache.NewInProcessStore()}
+				mock := newMockCache("core_store#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Store(store))
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				// written one by one
+				keys := []string{"core_store#1", "core_store#2"}
+				vs := make(map[string]*TestStruct)
+				err := mock.ehCache.GetObjects(ctx, keys, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					objs := make(map[string]any)
+					for _, key := range missingKeys {
+						objs[key] = &TestStruct{Name: key}
+					}
+					return objs, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				for _, key := range keys {
+					it, err := mock.tester.RedisItem(key, &TestStruct{})
+					Ω(err).ToNot(HaveOccurred())
+					Ω(it.Object).To(Equal(&TestStruct{Name: key}))
+				}
+
+				// touched with Get then Set
+				err = mock.ehCache.Touch(ctx, keys[0], time.Second*10)
+				Ω(err).ToNot(HaveOccurred())
+				it, err := mock.tester.RedisItem(keys[0], &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it.ExpireAt).To(BeNumerically(">", time.Now().Add(time.Second*9).UnixMilli()))
+
+				info, err := mock.ehCache.Inspect(ctx, keys[0])
+				Ω(err).ToNot(HaveOccurred())
+				Ω(info.InRedis).To(BeTrue())
+				Ω(info.RedisTTL).To(BeZero())
+
+				err = mock.ehCache.DeleteObjectType(ctx, "core_store")
+				Ω(errors.Is(err, cache.ErrNotSupported)).To(BeTrue())
+				err = mock.ehCache.DeleteByTag(ctx, "core#1")
+				Ω(errors.Is(err, cache.ErrNotSupported)).To(BeTrue())
+				var v TestStruct
+				err = mock.ehCache.GetObject(ctx, "core_store#3", &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				}, cache.LoadLock(time.Second))
+				Ω(errors.Is(err, cache.ErrNotSupported)).To(BeTrue())
+			})
+		})
+
+		Context("Test cluster", func() {
+			It("key slot ok", func() {
+				Ω(cache.KeySlot("foo")).To(Equal(12182))
+				Ω(cache.KeySlot("{user1000}.following")).To(Equal(cache.KeySlot("{user1000}.followers")))
+				Ω(cache.KeySlot("a:b{c}")).To(Equal(cache.KeySlot("c")))
+				// the first braces of a key win over the hash tag appended to it
+				Ω(cache.KeySlot("default:a{b}#1{a}")).To(Equal(cache.KeySlot("b")))
+			})
+
+			It("hash-tagged keys ok", func() {
+				key := "cluster_keys#1"
+				mock := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.Cluster(true))
+				mock.tester.DeleteFromRedis(key)
+				mock.tester.DeleteFromMem(key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return mock.val, nil
+				}, cache.Tags("cluster#1"))
+				Ω(err).ToNot(HaveOccurred())
+
+				conn, err := redis.Dial("tcp", "127.0.0.1:7379")
+				Ω(err).ToNot(HaveOccurred())
+				defer conn.Close()
+
+				// keys of an object type share a slot by default
+				exists, err := redis.Bool(conn.Do("EXISTS", "default:"+key+"{cluster_keys}"))
+				Ω(err).ToNot(HaveOccurred())
+				Ω(exists).To(BeTrue())
+
+				for _, m := range mock.tester.Metrics() {
+					if m.Key != "" {
+						Ω(m.Key).ToNot(ContainSubstring("{"))
+					}
+				}
+
+				err = mock.ehCache.Set(ctx, "cluster_keys#2", mock.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+				mock.tester.DeleteFromMem(key)
+				mock.tester.DeleteFromMem("cluster_keys#2")
+
+				vs := make(map[string]*TestStruct)
+				err = mock.ehCache.GetObjects(ctx, []string{key, "cluster_keys#2"}, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(HaveLen(2))
+
+				err = mock.ehCache.DeleteByTag(ctx, "cluster#1")
+				Ω(err).ToNot(HaveOccurred())
+				it, err := mock.tester.RedisItem(key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+
+				err = mock.ehCache.DeleteObjectType(ctx, "cluster_keys")
+				Ω(err).ToNot(HaveOccurred())
+				it, err = mock.tester.RedisItem("cluster_keys#2", &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+			})
+
+			It("multi-key operations split by slot", func() {
+				store := &slotStore{RemoteStore: cache.NewInProcessStore()}
+				// every key in its own slot
+				mock := newMockCache("cluster_slots#1", time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired,
+					cache.Store(store), cache.Cluster(true), cache.HashTag(func(key string) string { return key }))
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var keys []string
+				for i := 0; i < 20; i++ {
+					keys = append(keys, "cluster_slots#"+strconv.Itoa(i))
+				}
+				vs := make(map[string]*TestStruct)
+				err := mock.ehCache.GetObjects(ctx, keys, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					objs := make(map[string]any)
+					for _, key := range missingKeys {
+						objs[key] = &TestStruct{Name: key}
+					}
+					return objs, nil
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(HaveLen(len(keys)))
+
+				for _, key := range keys {
+					mock.tester.DeleteFromMem(key)
+				}
+				vs = make(map[string]*TestStruct)
+				err = mock.ehCache.GetObjects(ctx, keys, vs, time.Second*3, func(missingKeys []string) (map[string]any, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(vs).To(HaveLen(len(keys)))
+
+				store.mu.Lock()
+				defer store.mu.Unlock()
+				Ω(len(store.mgets)).To(BeNumerically(">", 1))
+				for _, mget := range store.mgets {
+					for _, key := range mget {
+						Ω(cache.KeySlot(key)).To(Equal(cache.KeySlot(mget[0])))
+					}
+				}
+			})
+
+			It("cluster client ok", func() {
+				key := "cluster_client#1"
+				client := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: []string{"127.0.0.1:7379"}})
+				// cluster mode is implied by a cluster client
+				mock1 := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.GoRedisClient(client))
+				mock2 := newMockCache(key, time.Millisecond*100, time.Second*1, false, cache.GetPolicyReturnExpired, cache.GoRedisClient(client))
+				mock1.tester.DeleteFromRedis(key)
+				mock1.tester.DeleteFromMem(key)
+				mock2.tester.DeleteFromMem(key)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				err := mock1.ehCache.Set(ctx, key, mock1.val, time.Second*3)
+				Ω(err).ToNot(HaveOccurred())
+
+				exists, err := client.Exists(ctx, "default:"+key+"{cluster_client}").Result()
+				Ω(err).ToNot(HaveOccurred())
+				Ω(exists).To(Equal(int64(1)))
+
+				var v TestStruct
+				err = mock2.ehCache.GetObject(ctx, key, &v, time.Second*3, func() (interface{}, error) {
+					return nil, errors.New("loader should not be called")
+				})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock1.val))
+
+				// deletion is broadcast, with plain pub-sub if sharded pub-sub is not supported
+				err = mock1.ehCache.DeleteObjectType(ctx, "cluster_client")
+				Ω(err).ToNot(HaveOccurred())
+				Ω(mock2.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+				Ω(mock2.tester.MemItem(key)).To(BeNil())
+				it, err := mock2.tester.RedisItem(key, &TestStruct{})
+				Ω(err).ToNot(HaveOccurred())
+				Ω(it).To(BeNil())
+			})
+		})
+
+		Context("Test hit EXPIRED with reloadOnExpiry", func() {
+			It("mem hit expired reload", func() {
+				mock := newMockCache("mem_hit_expired_reload#1", time.Millisecond*1200, time.Second*5, true, cache.GetPolicyReloadOnExpiry)
+				mock.tester.DeleteFromRedis(mock.key)
+				mock.tester.DeleteFromMem(mock.key)
+
+				loadFunc := func() (interface{}, error) {
+					time.Sleep(mock.delay)
+					return mock.val, nil
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+
+				var v TestStruct
+				err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				// expire mem
+				Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+
+				ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+				defer cancel()
+				err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*2, loadFunc)
+				Ω(err).ToNot(HaveOccurred())
+				Ω(&v).To(Equal(mock.val))
+
+				// wait last async load finish, make sure redis pub finished
+				Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+				Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+				metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
+					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeGetMemExpired,
+					cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache,
+				}
+				for idx, metricType := range metricList {
+					var mc metric
+					Ω(mock.metricChan).To(Receive(&mc))
+					Ω(mc.Key).To(Equal(mock.key))
+					Ω(mc.Type).To(Equal(metricType))
+					if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 12)) {
+						// a get_cache waiting for a load includes it
+						Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+						Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+					} else {
+						Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
+					}
+				}
+			})
+		})
+
+		It("redis hit expired reload", func() {
+			mock := newMockCache("redis_hit_expired_reload#1", time.Millisecond*1200, time.Second, true, cache.GetPolicyReloadOnExpiry)
+			mock.tester.DeleteFromRedis(mock.key)
+			mock.tester.DeleteFromMem(mock.key)
+
+			loadFunc := func() (interface{}, error) {
+				time.Sleep(mock.delay)
+				return mock.val, nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			var v TestStruct
+			err := mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(&v).To(Equal(mock.val))
+
+			// expire redis
+			Ω(mock.tester.Expire(mock.key)).ToNot(HaveOccurred())
+			mock.tester.DeleteFromMem(mock.key)
+
+			ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			err = mock.ehCache.GetObject(ctx, mock.key, &v, time.Second*1, loadFunc)
+			Ω(err).ToNot(HaveOccurred())
+			Ω(&v).To(Equal(mock.val))
+
+			// wait last async load finish, make sure redis pub finished
+			Ω(mock.tester.WaitLoads(ctx)).ToNot(HaveOccurred())
+			Ω(mock.tester.SyncPubSub(ctx)).ToNot(HaveOccurred())
+
+			metricList := []string{cache.MetricTypeDeleteRedis, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss, cache.MetricTypeGetRedisMiss,
+				cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache, cache.MetricTypeDeleteMem, cache.MetricTypeGetMemMiss,
+				cache.MetricTypeGetRedisExpired, cache.MetricTypeSetMem, cache.MetricTypeSetRedis, cache.MetricTypeLoad, cache.MetricTypeGetCache,
+			}
+
+			for idx, metricType := range metricList {
+				var mc metric
+				Ω(mock.metricChan).To(Receive(&mc))
+				Ω(mc.Key).To(Equal(mock.key))
+				Ω(mc.Type).To(Equal(metricType))
+				if mc.Type == cache.MetricTypeLoad || mc.Type == cache.MetricTypeAsyncLoad || (mc.Type == cache.MetricTypeGetCache && (idx == 7 || idx == 14)) {
+					// a get_cache waiting for a load includes it
+					Ω(mc.ElapsedTime).To(BeNumerically(">=", mock.delay))
+					Ω(mc.ElapsedTime).To(BeNumerically("<", mock.delay+elapsedSlack))
+				} else {
+					Ω(mc.ElapsedTime).To(BeNumerically("<", elapsedSlack))
+				}
+			}
+		})
+
+	})
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"strings"
+)
+
+// number of hash slots of a redis cluster
+const clusterSlots = 16384
+
+// KeySlot returns the redis cluster hash slot of key, only its hash tag is hashed if key has one.
+func KeySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % clusterSlots
+}
+
+// crc16 implements CRC16-CCITT (XMODEM), used by redis cluster for key slots.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// groupBySlot returns the indexes of keys grouped by slot, groups are in order of their first key.
+func groupBySlot(keys []string) [][]int {
+	var groups [][]int
+	slots := make(map[int]int)
+	for i, key := range keys {
+		slot := KeySlot(key)
+		g, ok := slots[slot]
+		if !ok {
+			g = len(groups)
+			slots[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// keysAt returns keys at indexes idxs.
+func keysAt(keys []string, idxs []int) []string {
+	picked := make([]string, len(idxs))
+	for i, idx := range idxs {
+		picked[i] = keys[idx]
+	}
+	return picked
+}
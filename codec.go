@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec serializes objects written to redis, the ID of the codec is stored along with the data,
+// so that data written with any codec known by the cache instance remains readable.
+type Codec interface {
+	// ID identifies the codec in redis data, must be unique and never change.
+	ID() string
+
+	Marshal(v any) ([]byte, error)
+
+	Unmarshal(data []byte, v any) error
+}
+
+// builtinCodecs can always be read, whatever the codec used to write.
+var builtinCodecs = []Codec{JSONCodec{}, ProtoCodec{}, GobCodec{}, MsgpackCodec{}}
+
+// JSONCodec encodes objects with encoding/json, and proto.Message with protojson. this is the default codec.
+type JSONCodec struct{}
+
+func (JSONCodec) ID() string {
+	return "json"
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return unmarshal(data, v)
+}
+
+// ProtoCodec encodes proto.Message in protobuf binary wire format, other objects can't be encoded.
+type ProtoCodec struct{}
+
+func (ProtoCodec) ID() string {
+	return "proto"
+}
+
+func (ProtoCodec) Marshal(v any) ([]byte, error) {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(pm)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v any) error {
+	pm, ok := v.(proto.Message)
+	if !ok {
+		return errors.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, pm)
+}
+
+// GobCodec encodes objects with encoding/gob.
+type GobCodec struct{}
+
+func (GobCodec) ID() string {
+	return "gob"
+}
+
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MsgpackCodec encodes objects with msgpack.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) ID() string {
+	return "msgpack"
+}
+
+func (MsgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+)
+
+// Compressor compresses objects written to redis, the ID of the compressor is stored along with the data,
+// so that data compressed with any compressor known by the cache instance remains readable.
+type Compressor interface {
+	// ID identifies the compressor in redis data, must be unique and never change.
+	ID() string
+
+	Compress(data []byte) ([]byte, error)
+
+	Decompress(data []byte) ([]byte, error)
+}
+
+// builtinCompressors can always be read, whatever the compressor used to write.
+var builtinCompressors = []Compressor{GzipCompressor{}, DeflateCompressor{}}
+
+// GzipCompressor compresses with gzip, Level is one of compress/flate levels, 0 for default compression.
+type GzipCompressor struct {
+	Level int
+}
+
+func (GzipCompressor) ID() string {
+	return "gzip"
+}
+
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, compressionLevel(g.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// DeflateCompressor compresses with deflate, Level is one of compress/flate levels, 0 for default compression.
+type DeflateCompressor struct {
+	Level int
+}
+
+func (DeflateCompressor) ID() string {
+	return "deflate"
+}
+
+func (d DeflateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, compressionLevel(d.Level))
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (DeflateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressionLevel returns the default compression level for 0.
+func compressionLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
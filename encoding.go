@@ -1,12 +1,157 @@
 package cache
 
 import (
+	"bytes"
 	"encoding/json"
 
+	"github.com/pkg/errors"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
+// payloadSeparator separates the envelope from the binary payload following it, never found in the envelope since
+// json.Marshal escapes newlines.
+const payloadSeparator = '\n'
+
+// envelope is the format of an item in redis, expire_at must be the first field, see touchScript.
+// objects encoded with JSONCodec are embedded as is in object, without codec, unless compressed or encrypted.
+// objects encoded with other codecs, compressed or encrypted follow the envelope as raw bytes, after payloadSeparator,
+// rather than base64 in json. only the object is encrypted, with the key of id kid.
+type envelope struct {
+	ExpireAt    int64           `json:"expire_at"`
+	Codec       string          `json:"codec,omitempty"`
+	Compression string          `json:"compression,omitempty"`
+	Kid         string          `json:"kid,omitempty"`
+	Object      json.RawMessage `json:"object,omitempty"`
+	NotFound    bool            `json:"not_found,omitempty"`
+	Delta       int64           `json:"delta,omitempty"`
+}
+
+// encodeItem marshal it into an envelope, its object is encoded with codec, then compressed with compressor if not nil and
+// the encoded object is at least threshold bytes, then encrypted with the current key of keys if not nil, aad is authenticated along.
+// raw is the size of the encoded object before compression, the size of body for a tombstone. compressed is its size after
+// compression, 0 if not compressed.
+func encodeItem(it *Item, codec Codec, compressor Compressor, threshold int, keys KeyProvider, aad []byte) (body []byte, raw, compressed int, err error) {
+	e := envelope{
+		ExpireAt: it.ExpireAt,
+		NotFound: it.NotFound,
+		Delta:    it.Delta,
+	}
+
+	// binary payload following the envelope
+	var data []byte
+
+	// no object for a tombstone
+	if !it.NotFound {
+		var bs []byte
+		if bs, err = codec.Marshal(it.Object); err != nil {
+			return
+		}
+
+		payload := bs
+		if compressor != nil && len(bs) >= threshold {
+			e.Compression = compressor.ID()
+			if payload, err = compressor.Compress(bs); err != nil {
+				return
+			}
+			compressed = len(payload)
+		}
+		raw = len(bs)
+
+		if keys != nil {
+			var key []byte
+			if e.Kid, key, err = keys.CurrentKey(); err != nil {
+				return
+			}
+			if payload, err = encrypt(key, payload, aad); err != nil {
+				return
+			}
+		}
+
+		if codec.ID() == (JSONCodec{}).ID() && e.Compression == "" && e.Kid == "" {
+			e.Object = payload
+		} else {
+			e.Codec = codec.ID()
+			data = payload
+		}
+	}
+
+	if body, err = json.Marshal(e); err != nil {
+		return
+	}
+	if e.Codec != "" {
+		body = append(append(body, payloadSeparator), data...)
+	}
+	if it.NotFound {
+		raw = len(body)
+	}
+	return
+}
+
+// decodeItem unmarshal an envelope, its object is decrypted with the key it was encrypted with and aad, then decompressed and decoded
+// into obj with the compressor and codec it was written with. the object is not decoded if obj is nil.
+// an object which can't be decrypted returns ErrDecrypt. raw is the size of the encoded object after decompression,
+// the size of data if the object is not decoded.
+func decodeItem(data []byte, obj any, codecs map[string]Codec, compressors map[string]Compressor, keys KeyProvider, aad []byte) (it *Item, raw int, err error) {
+	raw = len(data)
+	header, data, _ := bytes.Cut(data, []byte{payloadSeparator})
+
+	var e envelope
+	if err = json.Unmarshal(header, &e); err != nil {
+		return
+	}
+
+	it = &Item{
+		ExpireAt: e.ExpireAt,
+		NotFound: e.NotFound,
+		Delta:    e.Delta,
+	}
+	if it.NotFound || obj == nil {
+		return
+	}
+
+	// no codec for objects encoded with JSONCodec, including items written before codecs were introduced
+	payload, codec := []byte(e.Object), Codec(JSONCodec{})
+	if e.Codec != "" {
+		var ok bool
+		if codec, ok = codecs[e.Codec]; !ok {
+			return nil, 0, errors.Errorf("unknown codec %s", e.Codec)
+		}
+		payload = data
+	}
+
+	if e.Kid != "" {
+		if keys == nil {
+			return nil, 0, errors.Wrapf(ErrDecrypt, "no key provider for kid %s", e.Kid)
+		}
+
+		var key []byte
+		if key, err = keys.Key(e.Kid); err != nil {
+			return nil, 0, errors.Wrapf(ErrDecrypt, "kid %s: %v", e.Kid, err)
+		}
+		if payload, err = decrypt(key, payload, aad); err != nil {
+			return nil, 0, errors.Wrapf(ErrDecrypt, "kid %s: %v", e.Kid, err)
+		}
+	}
+
+	if e.Compression != "" {
+		compressor, ok := compressors[e.Compression]
+		if !ok {
+			return nil, 0, errors.Errorf("unknown compression %s", e.Compression)
+		}
+
+		if payload, err = compressor.Decompress(payload); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err = codec.Unmarshal(payload, obj); err != nil {
+		return nil, 0, err
+	}
+	it.Object = obj
+	return it, len(payload), nil
+}
+
 func marshal(v interface{}) ([]byte, error) {
 	protoVal, ok := v.(proto.Message)
 	if ok {
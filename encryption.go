@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+// KeyProvider provides the AES keys to encrypt objects written to redis, keys must be 16, 24 or 32 bytes.
+// the id of the key is stored along with the data, so that keys can be rotated while objects encrypted with previous keys
+// remain readable until they expire.
+type KeyProvider interface {
+	// CurrentKey returns the key to encrypt objects and its id.
+	CurrentKey() (kid string, key []byte, err error)
+
+	// Key returns the key of kid to decrypt objects.
+	Key(kid string) ([]byte, error)
+}
+
+// StaticKeyProvider provides keys by id from Keys, Current is the id of the key to encrypt objects.
+type StaticKeyProvider struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (p StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.Current)
+	return p.Current, key, err
+}
+
+func (p StaticKeyProvider) Key(kid string) ([]byte, error) {
+	key, ok := p.Keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key %s", kid)
+	}
+	return key, nil
+}
+
+// encrypt seal data with AES-GCM, the nonce is prepended to the result. aad is authenticated but not encrypted.
+func encrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(data)+gcm.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, aad), nil
+}
+
+// decrypt open data sealed by encrypt with the same key and aad.
+func decrypt(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+var (
+	goRedisTagScript    = goredis.NewScript(tagLua)
+	goRedisUnlockScript = goredis.NewScript(unlockLua)
+	goRedisTouchScript  = goredis.NewScript(touchLua)
+)
+
+// goRedisStore is the RemoteStore on redis with go-redis.
+type goRedisStore struct {
+	client goredis.UniversalClient
+
+	// sharded pub-sub is used with a cluster client, unless not supported by redis (before 7.0)
+	sharded atomic.Bool
+}
+
+// NewGoRedisStore create a RemoteStore on redis with a go-redis client, a single node, sentinel or cluster client.
+// with a cluster client, cluster mode is enabled on the cache, keys are scanned on all masters and messages are published with sharded pub-sub where available.
+func NewGoRedisStore(client goredis.UniversalClient) RemoteStore {
+	s := &goRedisStore{client: client}
+	s.sharded.Store(s.cluster())
+	return s
+}
+
+// cluster returns true with a cluster client.
+func (s *goRedisStore) cluster() bool {
+	_, ok := s.client.(*goredis.ClusterClient)
+	return ok
+}
+
+// unsupported returns true if err is the reply of redis to an unknown command.
+func unsupported(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "unknown command")
+}
+
+func (s *goRedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if err == goredis.Nil {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *goRedisStore) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	bs := make([][]byte, len(values))
+	for i, value := range values {
+		if value != nil {
+			bs[i] = []byte(value.(string))
+		}
+	}
+	return bs, nil
+}
+
+func (s *goRedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// MSet write values in a single pipeline.
+func (s *goRedisStore) MSet(ctx context.Context, values map[string][]byte, ttls map[string]time.Duration) error {
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, key, value, ttls[key])
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *goRedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Scan keys of every master with a cluster client, fn is not called concurrently.
+func (s *goRedisStore) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	cluster, ok := s.client.(*goredis.ClusterClient)
+	if !ok {
+		return scan(ctx, s.client, pattern, fn)
+	}
+
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, master *goredis.Client) error {
+		return scan(ctx, master, pattern, func(keys []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(keys)
+		})
+	})
+}
+
+// scan keys of a single node.
+func scan(ctx context.Context, client goredis.Cmdable, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, batchSize).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *goRedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// -2 and -1 are returned as is, not in milliseconds
+	switch {
+	case ttl == -2:
+		return 0, nil
+	case ttl < 0:
+		return -1, nil
+	}
+	return ttl, nil
+}
+
+func (s *goRedisStore) touch(ctx context.Context, key string, expireAt int64, ttl time.Duration) (bool, error) {
+	ms := int64(-1)
+	if ttl >= 0 {
+		ms = ttl.Milliseconds()
+	}
+	n, err := goRedisTouchScript.Run(ctx, s.client, []string{key}, expireAt, ms).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *goRedisStore) Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, key, token, ttl).Result()
+}
+
+func (s *goRedisStore) Unlock(ctx context.Context, key, token string) error {
+	return goRedisUnlockScript.Run(ctx, s.client, []string{key}, token).Err()
+}
+
+func (s *goRedisStore) Tag(ctx context.Context, tagKey, member string, ttl time.Duration) error {
+	sample, err := goRedisTagScript.Run(ctx, s.client, []string{tagKey}, member, ttl.Milliseconds(), tagPruneSample).StringSlice()
+	if err != nil {
+		return err
+	}
+
+	exists := make([]*goredis.IntCmd, len(sample))
+	if _, err = s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for i, m := range sample {
+			exists[i] = pipe.Exists(ctx, m)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	var gone []interface{}
+	for i, m := range sample {
+		if exists[i].Val() == 0 {
+			gone = append(gone, m)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	return s.client.SRem(ctx, tagKey, gone...).Err()
+}
+
+func (s *goRedisStore) Untag(ctx context.Context, tagKey string) ([]string, error) {
+	members, err := s.client.SMembers(ctx, tagKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(members); start += batchSize {
+		batch := members[start:min(start+batchSize, len(members))]
+		args := make([]interface{}, len(batch))
+		for i, member := range batch {
+			args[i] = member
+		}
+		if err = s.client.SRem(ctx, tagKey, args...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
+
+// Publish msgs in a single pipeline, with SPUBLISH if sharded.
+func (s *goRedisStore) Publish(ctx context.Context, channel string, msgs ...string) error {
+	sharded := s.sharded.Load()
+	_, err := s.client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, msg := range msgs {
+			if sharded {
+				pipe.SPublish(ctx, channel, msg)
+			} else {
+				pipe.Publish(ctx, channel, msg)
+			}
+		}
+		return nil
+	})
+	if sharded && unsupported(err) {
+		s.sharded.Store(false)
+		return s.Publish(ctx, channel, msgs...)
+	}
+	return err
+}
+
+// Subscribe with SSUBSCRIBE if sharded.
+func (s *goRedisStore) Subscribe(ctx context.Context, channel string, onMessage func(msg string)) (func() error, error) {
+	sharded := s.sharded.Load()
+	var pubsub *goredis.PubSub
+	if sharded {
+		pubsub = s.client.SSubscribe(ctx, channel)
+	} else {
+		pubsub = s.client.Subscribe(ctx, channel)
+	}
+
+	// subscribed once confirmed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		if sharded && unsupported(err) {
+			s.sharded.Store(false)
+			return s.Subscribe(ctx, channel, onMessage)
+		}
+		return nil, err
+	}
+
+	return func() error {
+		// reads are not interrupted by ctx, close pubsub once ctx is done so that ReceiveMessage returns
+		stop := context.AfterFunc(ctx, func() {
+			pubsub.Close()
+		})
+		defer func() {
+			if stop() {
+				pubsub.Close()
+			}
+		}()
+
+		for {
+			msg, err := pubsub.ReceiveMessage(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				// a new subscription is made by the cache
+				return err
+			}
+			onMessage(msg.Payload)
+		}
+	}, nil
+}
@@ -0,0 +1,408 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// interval between sweeps of expired keys of inProcessStore
+const inProcessSweepInterval = time.Minute
+
+// inProcessStore is a RemoteStore within the process, shared by the cache instances created with it.
+type inProcessStore struct {
+	mu sync.Mutex
+
+	// values and sets share the key space, like in redis
+	entries   map[string]*storeEntry
+	lastSweep time.Time
+
+	// subscribers by channel
+	subscribers map[string]map[*subscriber]struct{}
+}
+
+type storeEntry struct {
+	value   []byte
+	members map[string]struct{}
+
+	// zero for no expiration
+	expireAt time.Time
+}
+
+func (e *storeEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// subscriber queues messages to be handled by Subscribe, so that Publish never blocks.
+type subscriber struct {
+	mu     sync.Mutex
+	queue  []string
+	notify chan struct{}
+}
+
+// NewInProcessStore create a RemoteStore within the process, cache instances sharing it behave like instances sharing a redis.
+// typically for tests, or a single process which does not need redis.
+func NewInProcessStore() RemoteStore {
+	return &inProcessStore{
+		entries:     make(map[string]*storeEntry),
+		lastSweep:   time.Now(),
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// entry returns the live entry of key, nil if not found. must be called with mu held.
+func (s *inProcessStore) entry(key string, now time.Time) *storeEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// set write value of key, sweeping expired keys once in a while. must be called with mu held.
+func (s *inProcessStore) set(key string, value []byte, ttl time.Duration, now time.Time) {
+	e := &storeEntry{value: bytes.Clone(value)}
+	if ttl > 0 {
+		e.expireAt = now.Add(ttl)
+	}
+	s.entries[key] = e
+
+	if now.Sub(s.lastSweep) < inProcessSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *inProcessStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.entry(key, time.Now()); e != nil && e.members == nil {
+		return bytes.Clone(e.value), nil
+	}
+	return nil, nil
+}
+
+func (s *inProcessStore) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		if e := s.entry(key, now); e != nil && e.members == nil {
+			values[i] = bytes.Clone(e.value)
+		}
+	}
+	return values, nil
+}
+
+func (s *inProcessStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.set(key, value, ttl, time.Now())
+	return nil
+}
+
+func (s *inProcessStore) MSet(ctx context.Context, values map[string][]byte, ttls map[string]time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, value := range values {
+		s.set(key, value, ttls[key], now)
+	}
+	return nil
+}
+
+func (s *inProcessStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Scan call fn with a single batch of all keys matching pattern, fn is called without the lock held.
+func (s *inProcessStore) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	s.mu.Lock()
+	now := time.Now()
+	var keys []string
+	for key := range s.entries {
+		if s.entry(key, now) != nil && matchPattern(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return fn(keys)
+}
+
+func (s *inProcessStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entry(key, now)
+	switch {
+	case e == nil:
+		return 0, nil
+	case e.expireAt.IsZero():
+		return -1, nil
+	}
+	return e.expireAt.Sub(now), nil
+}
+
+func (s *inProcessStore) touch(ctx context.Context, key string, expireAt int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entry(key, now)
+	if e == nil || e.members != nil {
+		return false, nil
+	}
+
+	value, err := touchEnvelope(e.value, expireAt)
+	if err != nil {
+		return false, err
+	}
+	e.value = value
+	switch {
+	case ttl == 0:
+		e.expireAt = time.Time{}
+	case ttl > 0:
+		e.expireAt = now.Add(ttl)
+	}
+	return true, nil
+}
+
+func (s *inProcessStore) Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.entry(key, now) != nil {
+		return false, nil
+	}
+	s.set(key, []byte(token), ttl, now)
+	return true, nil
+}
+
+func (s *inProcessStore) Unlock(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e := s.entry(key, time.Now()); e != nil && e.members == nil && string(e.value) == token {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *inProcessStore) Tag(ctx context.Context, tagKey, member string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	e := s.entry(tagKey, now)
+	if e == nil || e.members == nil {
+		e = &storeEntry{members: make(map[string]struct{})}
+		if ttl > 0 {
+			e.expireAt = now.Add(ttl)
+		}
+		s.entries[tagKey] = e
+	}
+	e.members[member] = struct{}{}
+
+	// prune a few members whose key no longer exists
+	pruned := 0
+	for m := range e.members {
+		if pruned == tagPruneSample {
+			break
+		}
+		pruned++
+		if s.entry(m, now) == nil {
+			delete(e.members, m)
+		}
+	}
+
+	// the set lives at least ttl
+	switch {
+	case ttl == 0:
+		e.expireAt = time.Time{}
+	case !e.expireAt.IsZero() && e.expireAt.Before(now.Add(ttl)):
+		e.expireAt = now.Add(ttl)
+	}
+	return nil
+}
+
+func (s *inProcessStore) Untag(ctx context.Context, tagKey string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(tagKey, time.Now())
+	if e == nil || e.members == nil {
+		return nil, nil
+	}
+
+	members := make([]string, 0, len(e.members))
+	for member := range e.members {
+		members = append(members, member)
+	}
+	delete(s.entries, tagKey)
+	return members, nil
+}
+
+func (s *inProcessStore) Publish(ctx context.Context, channel string, msgs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscribers[channel] {
+		sub.mu.Lock()
+		sub.queue = append(sub.queue, msgs...)
+		sub.mu.Unlock()
+
+		select {
+		case sub.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *inProcessStore) Subscribe(ctx context.Context, channel string, onMessage func(msg string)) (func() error, error) {
+	sub := &subscriber{notify: make(chan struct{}, 1)}
+
+	s.mu.Lock()
+	if s.subscribers[channel] == nil {
+		s.subscribers[channel] = make(map[*subscriber]struct{})
+	}
+	s.subscribers[channel][sub] = struct{}{}
+	s.mu.Unlock()
+
+	return func() error {
+		defer func() {
+			s.mu.Lock()
+			delete(s.subscribers[channel], sub)
+			s.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-sub.notify:
+			}
+
+			sub.mu.Lock()
+			msgs := sub.queue
+			sub.queue = nil
+			sub.mu.Unlock()
+
+			for _, msg := range msgs {
+				onMessage(msg)
+			}
+		}
+	}, nil
+}
+
+// matchPattern reports whether s matches pattern, a redis glob-style pattern supporting *, ?, [...] and \ escapes.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// collapse consecutive stars, then try every suffix of s
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end, ok := matchClass(pattern, s[0])
+			if !ok {
+				return false
+			}
+			pattern, s = pattern[end:], s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass match c against the class starting at pattern[0] == '[', returns the index after the class.
+func matchClass(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		lo := pattern[i]
+		if lo == '\\' && i+1 < len(pattern) {
+			i++
+			lo = pattern[i]
+		}
+		hi := lo
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	// unterminated class matches up to the end of pattern, like redis
+	if i < len(pattern) {
+		i++
+	}
+	return i, matched != negate
+}
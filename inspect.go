@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Info describes the state of a key in cache.
+type Info struct {
+	// cached in-memory by this instance
+	InMem bool
+
+	// cached in redis
+	InRedis bool
+
+	// expiration of the object, from in-memory if cached, otherwise from redis. zero if it never expires.
+	ExpireAt time.Time
+
+	// remaining ttl of the key in redis, -1 if it has no expiration, 0 if not in redis or the store is not an Expirer.
+	RedisTTL time.Duration
+
+	// length of the item in redis, in bytes. 0 if not in redis.
+	Size int
+
+	// the object has expired, it is still returned by GetObject with GetPolicyReturnExpired.
+	Expired bool
+
+	// the object is a tombstone cached for ErrNotFound.
+	NotFound bool
+}
+
+func (c *cache) Peek(ctx context.Context, key string, obj any) error {
+	if c.closed.Load() {
+		return errors.WithStack(ErrClosed)
+	}
+
+	// nothing cached when disabled
+	if c.options.Disabled {
+		return errors.WithStack(ErrCacheMiss)
+	}
+
+	// no metric nor lru update for a read-only inspection
+	namespacedKey := c.namespacedKey(key)
+	it := c.mem.peek(namespacedKey)
+	if it == nil {
+		var err error
+		it, err = c.rds.peek(ctx, namespacedKey, obj)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if it == nil {
+			return errors.WithStack(ErrCacheMiss)
+		}
+	}
+
+	if it.NotFound {
+		return errors.WithStack(ErrNotFound)
+	}
+	return c.copy(ctx, it.Object, obj)
+}
+
+func (c *cache) Inspect(ctx context.Context, key string) (*Info, error) {
+	if c.closed.Load() {
+		return nil, errors.WithStack(ErrClosed)
+	}
+
+	info := &Info{}
+	// nothing cached when disabled
+	if c.options.Disabled {
+		return info, nil
+	}
+
+	namespacedKey := c.namespacedKey(key)
+	memItem := c.mem.peek(namespacedKey)
+
+	// the object type is unknown, the object is not decoded.
+	redisItem, size, err := c.rds.inspect(ctx, namespacedKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if redisItem != nil {
+		info.InRedis = true
+		info.Size = size
+		if info.RedisTTL, err = c.rds.pttl(ctx, namespacedKey); err != nil && !errors.Is(err, ErrNotSupported) {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	it := redisItem
+	if memItem != nil {
+		info.InMem = true
+		it = memItem
+	}
+	if it != nil {
+		if it.ExpireAt != 0 {
+			info.ExpireAt = time.UnixMilli(it.ExpireAt)
+		}
+		info.Expired = it.Expired()
+		info.NotFound = it.NotFound
+	}
+	return info, nil
+}
@@ -1,17 +1,22 @@
 package cache
 
 import (
-	"encoding/json"
+	"math"
 	"time"
-
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
 )
 
+// Sizer can be implemented by objects to report their in-memory size in bytes, which is the size of their encoding otherwise.
+type Sizer interface {
+	Size() int
+}
+
+// Item is a cached object, written to redis as an envelope, see encodeItem.
 type Item struct {
-	Object   interface{} `json:"object"`    // object
-	Size     int         `json:"size"`      // object size, in bytes.
-	ExpireAt int64       `json:"expire_at"` // data expiration timestamp. in milliseconds.
+	Object   interface{} // object
+	Size     int         // object size in-memory, in bytes.
+	ExpireAt int64       // data expiration timestamp. in milliseconds.
+	NotFound bool        // tombstone of an object which loader returned ErrNotFound, Object is nil.
+	Delta    int64       // time spent by loader function to load the object, in milliseconds.
 }
 
 func newItem(v interface{}, ttl time.Duration) *Item {
@@ -26,53 +31,40 @@ func newItem(v interface{}, ttl time.Duration) *Item {
 	}
 }
 
+// newNotFoundItem create a tombstone item.
+func newNotFoundItem(ttl time.Duration) *Item {
+	it := newItem(nil, ttl)
+	it.NotFound = true
+	return it
+}
+
 func (it *Item) Expired() bool {
 	return it.ExpireAt != 0 && it.ExpireAt < time.Now().UnixMilli()
 }
 
-func (i *Item) MarshalJSON() ([]byte, error) {
-	type Alias Item
-	obj := struct {
-		Object json.RawMessage `json:"object"`
-		*Alias
-	}{
-		Alias: (*Alias)(i),
+// setSize set Size from Sizer if implemented by the object, otherwise to n, the size of its encoding.
+// must be called before it is shared.
+func (it *Item) setSize(n int) {
+	if s, ok := it.Object.(Sizer); ok {
+		it.Size = s.Size()
+		return
 	}
-
-	var err error
-	if pm, ok := i.Object.(proto.Message); ok {
-		// Use protojson for proto.Message
-		obj.Object, err = protojson.Marshal(pm)
-	} else {
-		// Use json.Marshal for other types
-		obj.Object, err = json.Marshal(i.Object)
-	}
-	if err != nil {
-		return nil, err
-	}
-	return json.Marshal(obj)
+	it.Size = n
 }
 
-func (i *Item) UnmarshalJSON(data []byte) error {
-	type Alias Item
-	aux := &struct {
-		Object json.RawMessage `json:"object"`
-		*Alias
-	}{
-		Alias: (*Alias)(i),
-	}
-
-	if err := json.Unmarshal(data, &aux); err != nil {
-		return err
+// ttl returns the remaining time to live of it, 0 if it never expires. an expired item has 1ms left.
+func (it *Item) ttl() time.Duration {
+	if it.ExpireAt == 0 {
+		return 0
 	}
+	return max(time.Until(time.UnixMilli(it.ExpireAt)), time.Millisecond)
+}
 
-	// Replace this with your actual proto.Message
-	if pm, ok := i.Object.(proto.Message); ok {
-		if err := protojson.Unmarshal(aux.Object, pm); err != nil {
-			return err
-		}
-		i.Object = pm
-		return nil
+// refreshEarly implements XFetch, it returns true with a probability increasing as expiry approaches, earlier for a larger Delta.
+// beta > 1 favors earlier refresh, 0 to disable. r is a random number in (0, 1].
+func (it *Item) refreshEarly(beta, r float64) bool {
+	if beta <= 0 || it.ExpireAt == 0 || it.Delta == 0 {
+		return false
 	}
-	return json.Unmarshal(aux.Object, i.Object)
+	return float64(time.Now().UnixMilli())-float64(it.Delta)*beta*math.Log(r) >= float64(it.ExpireAt)
 }
@@ -1,28 +1,67 @@
 package cache
 
 import (
+	"container/list"
 	"strings"
 	"sync"
 	"time"
 )
 
+// max number of items checked by the janitor at once, not to hold the lock for the whole scan
+const cleanBatchSize = 1000
+
 type memCache struct {
-	// local cache
-	items sync.Map
+	// read locked by get unless bounded, the lru is updated then
+	mu sync.RWMutex
+
+	// local cache, key -> element of lru
+	items map[string]*list.Element
+
+	// entries from most to least recently used, reordered by get only if bounded
+	lru *list.List
+
+	// total size of items, in bytes
+	size int
+
+	// max number of items and total size of items, 0 for unlimited
+	maxEntries int
+	maxBytes   int
+
+	// evictions per object type since last report
+	evictions map[string]int
+
+	// items of an object type with DisableMem or larger than MaxMemSize are not cached
+	objectTypes map[string]ObjectTypeConfig
 
 	// clean interval
 	ci time.Duration
 
 	// metric for mem cache
 	metric Metrics
+
+	// closed to stop janitor
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type memEntry struct {
+	key string
+	it  *Item
 }
 
 // newMemCache memcache will scan all objects for every clean interval and delete expired key.
-func newMemCache(ci time.Duration, metric Metrics) *memCache {
+// least recently used items are evicted once maxEntries or maxBytes is exceeded, 0 for unlimited.
+func newMemCache(ci time.Duration, maxEntries, maxBytes int, objectTypes map[string]ObjectTypeConfig, metric Metrics) *memCache {
 	c := &memCache{
-		items:  sync.Map{},
-		ci:     ci,
-		metric: metric,
+		items:       make(map[string]*list.Element),
+		lru:         list.New(),
+		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
+		evictions:   make(map[string]int),
+		objectTypes: objectTypes,
+		ci:          ci,
+		metric:      metric,
+		stop:        make(chan struct{}),
 	}
 
 	go c.runJanitor()
@@ -34,26 +73,107 @@ func (c *memCache) get(key string) *Item {
 	var metricType string
 	defer c.metric.Observe()(key, &metricType, nil)
 
-	tmp, ok := c.items.Load(key)
-	if !ok {
-		metricType = MetricTypeGetMemMiss
-		return nil
+	var it *Item
+	if c.bounded() {
+		c.mu.Lock()
+		if e, ok := c.items[key]; ok {
+			c.lru.MoveToFront(e)
+			it = e.Value.(*memEntry).it
+		}
+		c.mu.Unlock()
+	} else {
+		it = c.peek(key)
 	}
 
-	it := tmp.(*Item)
-	if !it.Expired() {
-		metricType = MetricTypeGetMemHit
-	} else {
+	switch {
+	case it == nil:
+		metricType = MetricTypeGetMemMiss
+	case it.Expired():
 		metricType = MetricTypeGetMemExpired
+	case it.NotFound:
+		metricType = MetricTypeGetMemNotFound
+	default:
+		metricType = MetricTypeGetMemHit
 	}
 	return it
 }
 
+// peek an item from the memcache without metric, returns nil if not found.
+func (c *memCache) peek(key string) *Item {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	return e.Value.(*memEntry).it
+}
+
 func (c *memCache) set(key string, it *Item) {
-	// mem set
-	defer c.metric.Observe()(key, MetricTypeSetMem, nil)
+	c.put(key, nil, it)
+}
+
+// replace set it as the item of key only if its current item is still old, so that a concurrent set or delete is not undone.
+// key is deleted if it is nil.
+func (c *memCache) replace(key string, old, it *Item) {
+	c.put(key, old, it)
+}
+
+// put set it as the item of key, or delete key if it is nil or not admitted. if old is not nil, nothing is done unless
+// the current item of key is old.
+func (c *memCache) put(key string, old, it *Item) {
+	metricType := MetricTypeSetMem
+	if it == nil || !c.admit(key, it) {
+		// drop the previous item which is stale now
+		metricType = MetricTypeDeleteMem
+	}
+	observe := c.metric.Observe()
 
-	c.items.Store(key, it)
+	c.mu.Lock()
+	e, ok := c.items[key]
+	if old != nil && (!ok || e.Value.(*memEntry).it != old) {
+		c.mu.Unlock()
+		return
+	}
+
+	switch {
+	case metricType == MetricTypeDeleteMem:
+		if ok {
+			c.remove(e)
+		}
+	case ok:
+		entry := e.Value.(*memEntry)
+		c.size += it.Size - entry.it.Size
+		entry.it = it
+		c.lru.MoveToFront(e)
+		c.evict()
+	default:
+		c.items[key] = c.lru.PushFront(&memEntry{key: key, it: it})
+		c.size += it.Size
+		c.evict()
+	}
+	c.mu.Unlock()
+
+	observe(key, metricType, nil)
+}
+
+// touch set the ExpireAt of the item of key, returns false if not found.
+// a copy is stored, a cached item is never modified in place since it may be read concurrently.
+func (c *memCache) touch(key string, expireAt int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return false
+	}
+
+	entry := e.Value.(*memEntry)
+	it := *entry.it
+	it.ExpireAt = expireAt
+	entry.it = &it
+	return true
 }
 
 // Delete an item from the memcache. Does nothing if the key is not in the memcache.
@@ -61,7 +181,60 @@ func (c *memCache) delete(key string) {
 	// mem del
 	defer c.metric.Observe()(key, MetricTypeDeleteMem, nil)
 
-	c.items.Delete(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+}
+
+// deletePrefix delete all items with key starting with prefix.
+func (c *memCache) deletePrefix(prefix string) {
+	var keys []string
+	c.mu.RLock()
+	for key := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, key := range keys {
+		c.delete(key)
+	}
+}
+
+// admit returns false if it should not be cached according to the config of its object type.
+func (c *memCache) admit(key string, it *Item) bool {
+	config, ok := c.objectTypes[c.metric.objectType(key)]
+	if !ok {
+		return true
+	}
+	return !config.DisableMem && (config.MaxMemSize == 0 || it.Size <= config.MaxMemSize)
+}
+
+// bounded returns true if there is any limit on items.
+func (c *memCache) bounded() bool {
+	return c.maxEntries > 0 || c.maxBytes > 0
+}
+
+// evict remove least recently used items until limits are respected, must be called with mu held.
+// an item larger than maxBytes by itself is evicted as well.
+func (c *memCache) evict() {
+	for c.lru.Len() > 0 && ((c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.size > c.maxBytes)) {
+		e := c.lru.Back()
+		c.remove(e)
+		c.evictions[c.metric.objectType(e.Value.(*memEntry).key)]++
+	}
+}
+
+// remove e from items, must be called with mu held.
+func (c *memCache) remove(e *list.Element) {
+	entry := e.Value.(*memEntry)
+	c.lru.Remove(e)
+	delete(c.items, entry.key)
+	c.size -= entry.it.Size
 }
 
 // start key scanning to delete expired keys
@@ -73,44 +246,80 @@ func (c *memCache) runJanitor() {
 		select {
 		case <-ticker.C:
 			c.DeleteExpired()
+		case <-c.stop:
+			return
 		}
 	}
 }
 
+// close stop the janitor, items are kept.
+func (c *memCache) close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
 type memStat struct {
-	count    int
-	memUsage int
+	count     int
+	memUsage  int
+	evictions int
 }
 
-// DeleteExpired delete all expired items from the memcache.
+// DeleteExpired delete all expired items from the memcache, cleanBatchSize items at a time.
 func (c *memCache) DeleteExpired() {
 	ms := make(map[string]*memStat)
-	c.items.Range(func(key, value interface{}) bool {
-		v := value.(*Item)
-		k := key.(string)
-
-		objectType := strings.Split(strings.TrimPrefix(k, c.metric.namespace+":"), c.metric.separator)[0]
-		stat, ok := ms[objectType]
+	stat := func(objectType string) *memStat {
+		s, ok := ms[objectType]
 		if !ok {
-			stat = &memStat{
-				count:    1,
-				memUsage: v.Size,
-			}
-		} else {
-			stat.count += 1
-			stat.memUsage += v.Size
+			s = &memStat{}
+			ms[objectType] = s
 		}
-		ms[objectType] = stat
+		return s
+	}
 
-		// delete outdated for memory cache
-		if v.Expired() {
-			c.items.Delete(k)
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	c.mu.RUnlock()
+
+	for start := 0; start < len(keys); start += cleanBatchSize {
+		c.mu.Lock()
+		for _, k := range keys[start:min(start+cleanBatchSize, len(keys))] {
+			// deleted meanwhile
+			e, ok := c.items[k]
+			if !ok {
+				continue
+			}
+			v := e.Value.(*memEntry).it
+
+			s := stat(c.metric.objectType(k))
+			s.count += 1
+			s.memUsage += v.Size
+
+			// delete outdated for memory cache
+			if v.Expired() {
+				c.remove(e)
+			}
 		}
-		return true
-	})
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	// evictions are reported for object types evicted since last report
+	for objectType, n := range c.evictions {
+		stat(objectType).evictions = n
+	}
+	clear(c.evictions)
+	bounded := c.bounded()
+	c.mu.Unlock()
 
 	for k, v := range ms {
 		c.metric.Set(k, MetricTypeCount, v.count)
 		c.metric.Set(k, MetricTypeMemUsage, v.memUsage)
+		if bounded {
+			c.metric.Set(k, MetricTypeEviction, v.evictions)
+		}
 	}
 }
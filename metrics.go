@@ -6,23 +6,36 @@ import (
 )
 
 const (
-	MetricTypeGetMemHit       = "get_mem_hit"
-	MetricTypeGetMemMiss      = "get_mem_miss"
-	MetricTypeGetMemExpired   = "get_mem_expired"
-	MetricTypeGetRedisHit     = "get_redis_hit"
-	MetricTypeGetRedisMiss    = "get_redis_miss"
-	MetricTypeGetRedisExpired = "get_redis_expired"
-	MetricTypeGetCache        = "get_cache"
-	MetricTypeLoad            = "load"
-	MetricTypeAsyncLoad       = "async_load"
-	MetricTypeSetCache        = "set_cache"
-	MetricTypeSetMem          = "set_mem"
-	MetricTypeSetRedis        = "set_redis"
-	MetricTypeDeleteCache     = "del_cache"
-	MetricTypeDeleteMem       = "del_mem"
-	MetricTypeDeleteRedis     = "del_redis"
-	MetricTypeCount           = "count"
-	MetricTypeMemUsage        = "mem_usage"
+	MetricTypeGetMemHit        = "get_mem_hit"
+	MetricTypeGetMemMiss       = "get_mem_miss"
+	MetricTypeGetMemExpired    = "get_mem_expired"
+	MetricTypeGetMemNotFound   = "get_mem_not_found"
+	MetricTypeGetRedisHit      = "get_redis_hit"
+	MetricTypeGetRedisMiss     = "get_redis_miss"
+	MetricTypeGetRedisExpired  = "get_redis_expired"
+	MetricTypeGetRedisNotFound = "get_redis_not_found"
+	MetricTypeGetCache         = "get_cache"
+	MetricTypeLoad             = "load"
+	MetricTypeAsyncLoad        = "async_load"
+	MetricTypeStaleIfError     = "stale_if_error"
+	MetricTypeEarlyRefresh     = "early_refresh"
+	MetricTypeLockAcquired     = "lock_acquired"
+	MetricTypeLockWait         = "lock_wait"
+	MetricTypeLockTimeout      = "lock_timeout"
+	MetricTypeSetCache         = "set_cache"
+	MetricTypeSetMem           = "set_mem"
+	MetricTypeSetRedis         = "set_redis"
+	MetricTypeTouch            = "touch"
+	MetricTypeDeleteCache      = "del_cache"
+	MetricTypeDeleteMem        = "del_mem"
+	MetricTypeDeleteRedis      = "del_redis"
+	MetricTypeDeleteTag        = "del_tag"
+	MetricTypeDeleteType       = "del_type"
+	MetricTypeCount            = "count"
+	MetricTypeMemUsage         = "mem_usage"
+	MetricTypeEviction         = "eviction"
+	MetricTypeRawSize          = "raw_size"
+	MetricTypeCompressedSize   = "compressed_size"
 )
 
 type Metrics struct {
@@ -31,6 +44,9 @@ type Metrics struct {
 
 	separator string
 
+	// keys end with a hash tag in cluster mode, need trim it as well
+	cluster bool
+
 	onMetric func(key, objectType string, metricType string, count int, elapsedTime time.Duration)
 }
 
@@ -55,10 +71,24 @@ func (m Metrics) Observe() func(string, interface{}, *error) {
 		default:
 			return
 		}
-		key := strings.TrimPrefix(namespacedKey, m.namespace+":")
-		objectType := strings.Split(key, m.separator)[0]
-		m.onMetric(key, objectType, metric, 0, time.Since(start))
+		m.onMetric(m.key(namespacedKey), m.objectType(namespacedKey), metric, 0, time.Since(start))
+	}
+}
+
+// key returns the key of namespacedKey, which is in format namespace:key, followed by {hashTag} in cluster mode.
+func (m Metrics) key(namespacedKey string) string {
+	key := strings.TrimPrefix(namespacedKey, m.namespace+":")
+	if m.cluster && strings.HasSuffix(key, "}") {
+		if i := strings.LastIndexByte(key, '{'); i >= 0 {
+			key = key[:i]
+		}
 	}
+	return key
+}
+
+// objectType extract the object type of namespacedKey, whose key is in format objectType{separator}id.
+func (m Metrics) objectType(namespacedKey string) string {
+	return strings.Split(m.key(namespacedKey), m.separator)[0]
 }
 
 // Set used for gauge metrics, counts and memory usage metrics
@@ -68,3 +98,11 @@ func (m Metrics) Set(objectType, metric string, count int) {
 	}
 	m.onMetric("*", objectType, metric, count, 0)
 }
+
+// Size used for size metrics of namespacedKey, in bytes
+func (m Metrics) Size(namespacedKey, metric string, size int) {
+	if m.onMetric == nil {
+		return
+	}
+	m.onMetric(m.key(namespacedKey), m.objectType(namespacedKey), metric, size, 0)
+}
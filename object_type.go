@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"time"
+)
+
+// ObjectTypeConfig is the configuration of all keys of an object type, which is the prefix of key before Separator.
+// zero values fall back to global options, options of a call take precedence.
+type ObjectTypeConfig struct {
+	// ttl of a call with 0 ttl, must be in whole numbers of seconds.
+	TTL time.Duration
+
+	// redis ttl = ttl*RedisTTLFactor
+	RedisTTLFactor int
+
+	// get policy when data is expired, ReturnExpired or ReloadOnExpiry
+	GetPolicy GetCachePolicy
+
+	// objects are not cached in-memory, they are read from redis every time.
+	DisableMem bool
+
+	// objects larger than MaxMemSize bytes are not cached in-memory, 0 for unlimited.
+	MaxMemSize int
+}
+
+// objectTypeConfig returns the configuration of the object type of namespacedKey, zero value if not registered.
+func (c *cache) objectTypeConfig(namespacedKey string) ObjectTypeConfig {
+	return c.options.ObjectTypes[c.metric.objectType(namespacedKey)]
+}
+
+// ttl returns ttl if not 0, otherwise the ttl of the object type of namespacedKey.
+func (c *cache) ttl(namespacedKey string, ttl time.Duration) time.Duration {
+	if ttl != 0 {
+		return ttl
+	}
+	return c.objectTypeConfig(namespacedKey).TTL
+}
+
+// getPolicy returns the get policy from input if provided, otherwise from the object type of namespacedKey, then from global options.
+func (c *cache) getPolicy(namespacedKey string, opt Options) GetCachePolicy {
+	if opt.GetPolicy != 0 {
+		return opt.GetPolicy
+	}
+	if getPolicy := c.objectTypeConfig(namespacedKey).GetPolicy; getPolicy != 0 {
+		return getPolicy
+	}
+	return c.options.GetPolicy
+}
@@ -2,9 +2,11 @@ package cache
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 type GetCachePolicy int
@@ -14,6 +16,14 @@ const (
 	GetPolicyReloadOnExpiry
 )
 
+type UpdateCachePolicy int
+
+const (
+	UpdatePolicyNoBroadcast UpdateCachePolicy = iota + 1
+	UpdatePolicyBroadcast
+	UpdatePolicyBroadcastReload
+)
+
 type Options struct {
 	Namespace string
 
@@ -24,18 +34,76 @@ type Options struct {
 	// clean interval for in-memory cache
 	CleanInterval time.Duration
 
+	// max number of items in-memory, least recently used items are evicted once exceeded. 0 for unlimited.
+	MaxMemEntries int
+
+	// max total size of items in-memory in bytes, from Item.Size, least recently used items are evicted once exceeded. 0 for unlimited.
+	MaxMemBytes int
+
 	// get policy when data is expired, ReturnExpired or ReloadOnExpiry
 	GetPolicy GetCachePolicy
 
+	// configuration per object type, registered with ObjectType.
+	ObjectTypes map[string]ObjectTypeConfig
+
+	// update policy when data is reloaded with loader function, NoBroadcast, Broadcast or BroadcastReload
+	UpdatePolicy UpdateCachePolicy
+
+	// ttl of the tombstone cached when loader returns ErrNotFound, use the ttl of the call if not specified.
+	NotFoundTTL time.Duration
+
+	// with GetPolicyReloadOnExpiry, return the expired object if reload fails and it has been expired for less than StaleIfError.
+	StaleIfError time.Duration
+
+	// reload object asynchronously ahead of expiry with XFetch probabilistic early expiration, the larger the earlier, 1.0 is a good default.
+	// the time spent by loader function is taken into account, so that expensive objects are reloaded earlier. 0 to disable.
+	EarlyRefresh float64
+
+	// randomize the ttl of every object written within ±TTLJitter*ttl, in both memory and redis, so that objects loaded together
+	// do not expire at the same time. must be in [0, 1), per call values out of range are ignored. 0 to disable.
+	TTLJitter float64
+
+	// acquire a lease in redis for LoadLock before calling loader function of GetObject, so that only one instance loads a key at a time.
+	// other instances wait at most LoadLock for the object to be written to redis, then fall back to the expired object if any,
+	// otherwise call loader function. 0 to disable.
+	LoadLock time.Duration
+
+	// source of randomness for TTLJitter and EarlyRefresh, seeded with current time if not specified.
+	RandSource rand.Source
+
 	// will call loader function when disabled id true
 	Disabled bool
 
 	// redis ttl = ttl*RedisTTLFactor, data in redis lives longer than memory cache.
 	RedisTTLFactor int
 
-	// retrieve redis connection
+	// codec of objects written to redis, JSONCodec if not specified. objects written with any built-in codec or Codec can be read,
+	// so that a namespace can be migrated from a codec to another.
+	Codec Codec
+
+	// compressor of objects written to redis whose encoding is at least CompressThreshold bytes, no compression if not specified.
+	// objects compressed with any built-in compressor or Compressor can be read.
+	Compressor        Compressor
+	CompressThreshold int
+
+	// provider of the keys to encrypt objects written to redis with AES-GCM, no encryption if not specified.
+	KeyProvider KeyProvider
+
+	// retrieve redis connection, to use redis with redigo as store
 	GetConn func() redis.Conn
 
+	// go-redis client, to use redis with go-redis as store, takes precedence over GetConn
+	GoRedisClient goredis.UniversalClient
+
+	// store of the shared tier, takes precedence over GoRedisClient and GetConn
+	Store RemoteStore
+
+	// redis cluster mode, keys end with a hash tag and multi-key operations are split by slot
+	Cluster bool
+
+	// hash tag of a key in cluster mode, its object type if not specified
+	HashTag func(key string) string
+
 	// metrics
 	Metric Metrics
 
@@ -44,6 +112,15 @@ type Options struct {
 
 	// enable debug logging for cache operations
 	DebugLog bool
+
+	// tags of the key written to redis, all keys of a tag can be deleted with DeleteByTag. per call only.
+	Tags []string
+
+	// push the expiration of the object forward by ttl on every hit of GetObject, without reloading. per call only.
+	SlidingExpiration bool
+
+	// called for every message received from the delete channel, the message is consumed if it returns true. for test purpose.
+	onMessage func(msg string) bool
 }
 
 type Option func(*Options)
@@ -66,6 +143,55 @@ func CleanInterval(cleanInterval time.Duration) Option {
 	}
 }
 
+func MaxMemEntries(maxEntries int) Option {
+	return func(o *Options) {
+		o.MaxMemEntries = maxEntries
+	}
+}
+
+func MaxMemBytes(maxBytes int) Option {
+	return func(o *Options) {
+		o.MaxMemBytes = maxBytes
+	}
+}
+
+func NotFoundTTL(notFoundTTL time.Duration) Option {
+	return func(o *Options) {
+		o.NotFoundTTL = notFoundTTL
+	}
+}
+
+func StaleIfError(maxStale time.Duration) Option {
+	return func(o *Options) {
+		o.StaleIfError = maxStale
+	}
+}
+
+func EarlyRefresh(beta float64) Option {
+	return func(o *Options) {
+		o.EarlyRefresh = beta
+	}
+}
+
+func TTLJitter(fraction float64) Option {
+	return func(o *Options) {
+		o.TTLJitter = fraction
+	}
+}
+
+// RandSeed makes TTLJitter and EarlyRefresh deterministic, for test purpose.
+func RandSeed(seed int64) Option {
+	return func(o *Options) {
+		o.RandSource = rand.NewSource(seed)
+	}
+}
+
+func LoadLock(lease time.Duration) Option {
+	return func(o *Options) {
+		o.LoadLock = lease
+	}
+}
+
 func Disabled(disabled bool) Option {
 	return func(o *Options) {
 		o.Disabled = disabled
@@ -78,12 +204,63 @@ func RedisTTLFactor(redisTTLFactor int) Option {
 	}
 }
 
+func Encoding(codec Codec) Option {
+	return func(o *Options) {
+		o.Codec = codec
+	}
+}
+
+// Compression compress objects written to redis with compressor when their encoding is at least threshold bytes.
+func Compression(compressor Compressor, threshold int) Option {
+	return func(o *Options) {
+		o.Compressor = compressor
+		o.CompressThreshold = threshold
+	}
+}
+
+// Encryption encrypt objects written to redis with the current key of provider, objects which can't be decrypted are treated as misses.
+func Encryption(provider KeyProvider) Option {
+	return func(o *Options) {
+		o.KeyProvider = provider
+	}
+}
+
 func GetConn(getConn func() redis.Conn) Option {
 	return func(o *Options) {
 		o.GetConn = getConn
 	}
 }
 
+// GoRedisClient use redis with a go-redis client as store, instead of redigo.
+func GoRedisClient(client goredis.UniversalClient) Option {
+	return func(o *Options) {
+		o.GoRedisClient = client
+	}
+}
+
+// Cluster enable redis cluster mode, always enabled with a go-redis ClusterClient.
+func Cluster(enabled bool) Option {
+	return func(o *Options) {
+		o.Cluster = enabled
+	}
+}
+
+// HashTag set the hash tag of keys in cluster mode, keys with the same hash tag are in the same slot.
+// the hash tag is appended to the key and redis cluster hashes the first {...} of a key, so keys must not contain '{' for
+// it to apply, a key containing '{' is placed by its own braces instead. multi-key operations are still split by actual slot.
+func HashTag(hashTag func(key string) string) Option {
+	return func(o *Options) {
+		o.HashTag = hashTag
+	}
+}
+
+// Store set the store of the shared tier, to use another backend than redis with redigo.
+func Store(store RemoteStore) Option {
+	return func(o *Options) {
+		o.Store = store
+	}
+}
+
 func OnMetric(onMetric func(key, objectType string, metricType string, count int, elapsedTime time.Duration)) Option {
 	return func(o *Options) {
 		o.Metric = Metrics{
@@ -104,12 +281,42 @@ func GetPolicy(getPolicy GetCachePolicy) Option {
 	}
 }
 
+func UpdatePolicy(updatePolicy UpdateCachePolicy) Option {
+	return func(o *Options) {
+		o.UpdatePolicy = updatePolicy
+	}
+}
+
+// ObjectType register the configuration of objectType, which applies to all keys in format objectType{Separator}id.
+func ObjectType(objectType string, config ObjectTypeConfig) Option {
+	return func(o *Options) {
+		if o.ObjectTypes == nil {
+			o.ObjectTypes = make(map[string]ObjectTypeConfig)
+		}
+		o.ObjectTypes[objectType] = config
+	}
+}
+
 func DebugLog(debugLog bool) Option {
 	return func(o *Options) {
 		o.DebugLog = debugLog
 	}
 }
 
+// Tags add the object to tags, to delete all objects of a tag at once with DeleteByTag.
+// keys which expire are pruned from tags lazily, a tag holds about twice as many keys as live ones at most.
+func Tags(tags ...string) Option {
+	return func(o *Options) {
+		o.Tags = append(o.Tags, tags...)
+	}
+}
+
+func SlidingExpiration(sliding bool) Option {
+	return func(o *Options) {
+		o.SlidingExpiration = sliding
+	}
+}
+
 func newOptions(opts ...Option) Options {
 	opt := Options{}
 	for _, o := range opts {
@@ -1,111 +1,416 @@
 package cache
 
 import (
+	"context"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
 )
 
+// max number of keys sent in one command
+const batchSize = 500
+
+// number of random members of a tag set checked on each tag, members whose key has expired are removed.
+// a set holds about twice as many members as live keys at most.
+const tagPruneSample = 2
+
+// redisCache is the shared tier of the cache, items are encoded into envelopes and written to store, redis by default.
 type redisCache struct {
-	// func to get redis conn from pool
-	getConn func() redis.Conn
+	// store of the envelopes
+	store RemoteStore
 
 	// TTL in redis will be redisTTLFactor*mem_ttl
 	redisTTLFactor int
 
+	// redisTTLFactor per object type, take precedence over redisTTLFactor
+	redisTTLFactors map[string]int
+
+	// codec to write objects, and all codecs to read them by ID
+	codec  Codec
+	codecs map[string]Codec
+
+	// compressor to write objects of at least compressThreshold bytes, nil for no compression.
+	// all compressors to read them by ID.
+	compressor        Compressor
+	compressThreshold int
+	compressors       map[string]Compressor
+
+	// provider of the keys to encrypt and decrypt objects, nil for no encryption
+	keys KeyProvider
+
+	// redis cluster mode, multi-key operations are split by slot
+	cluster bool
+
+	// report objects which can't be decrypted, they are treated as misses
+	onError func(err error)
+
 	// metric for redis cache
 	metric Metrics
 }
 
-func newRedisCache(getConn func() redis.Conn, redisTTLFactor int, metric Metrics) *redisCache {
+func newRedisCache(store RemoteStore, redisTTLFactor int, redisTTLFactors map[string]int, codec Codec, compressor Compressor, compressThreshold int, keys KeyProvider, cluster bool, metric Metrics) *redisCache {
+	codecs := make(map[string]Codec, len(builtinCodecs)+1)
+	for _, builtin := range builtinCodecs {
+		codecs[builtin.ID()] = builtin
+	}
+	codecs[codec.ID()] = codec
+
+	compressors := make(map[string]Compressor, len(builtinCompressors)+1)
+	for _, builtin := range builtinCompressors {
+		compressors[builtin.ID()] = builtin
+	}
+	if compressor != nil {
+		compressors[compressor.ID()] = compressor
+	}
+
 	return &redisCache{
-		getConn:        getConn,
-		redisTTLFactor: redisTTLFactor,
-		metric:         metric,
+		store:             store,
+		redisTTLFactor:    redisTTLFactor,
+		redisTTLFactors:   redisTTLFactors,
+		codec:             codec,
+		codecs:            codecs,
+		compressor:        compressor,
+		compressThreshold: compressThreshold,
+		compressors:       compressors,
+		keys:              keys,
+		cluster:           cluster,
+		metric:            metric,
 	}
 }
 
 // read item from redis
-func (c *redisCache) get(key string, obj interface{}) (it *Item, err error) {
+func (c *redisCache) get(ctx context.Context, key string, obj interface{}) (it *Item, err error) {
 	var metricType string
 	defer c.metric.Observe()(key, &metricType, &err)
 
-	body, err := c.getString(key)
+	body, err := c.store.Get(ctx, key)
+	if err != nil {
+		return
+	}
+	if body == nil {
+		metricType = MetricTypeGetRedisMiss
+		return
+	}
+
+	it, err = c.decode(key, body, obj)
 	if err != nil {
-		if err == redis.ErrNil {
+		if errors.Is(err, ErrDecrypt) {
 			metricType = MetricTypeGetRedisMiss
 			err = nil
-			return
-		} else {
-			return
 		}
+		return
+	}
+	metricType = c.hitMetric(it)
+	return
+}
+
+// peek read item from redis without updating any metric, nil if not found.
+func (c *redisCache) peek(ctx context.Context, key string, obj interface{}) (*Item, error) {
+	body, err := c.store.Get(ctx, key)
+	if err != nil || body == nil {
+		return nil, err
 	}
 
-	it = &Item{}
-	it.Object = obj
-	err = unmarshal([]byte(body), it)
+	it, err := c.decode(key, body, obj)
+	if errors.Is(err, ErrDecrypt) {
+		return nil, nil
+	}
+	return it, err
+}
+
+// inspect read item of key from redis without its object nor updating any metric, nil if not found.
+// size is the length of the item in redis.
+func (c *redisCache) inspect(ctx context.Context, key string) (it *Item, size int, err error) {
+	body, err := c.store.Get(ctx, key)
+	if err != nil || body == nil {
+		return nil, 0, err
+	}
+
+	it, err = c.decode(key, body, nil)
+	return it, len(body), err
+}
+
+// mget read items of keys from redis at once, or slot by slot in cluster mode. returned items have the same order as keys, nil for a miss.
+// newObj is called for each found key to allocate the object to unmarshal into.
+func (c *redisCache) mget(ctx context.Context, keys []string, newObj func() any) (its []*Item, err error) {
+	values, err := c.storeMGet(ctx, keys)
 	if err != nil {
 		return
 	}
 
-	if !it.Expired() {
-		metricType = MetricTypeGetRedisHit
-	} else {
-		metricType = MetricTypeGetRedisExpired
+	its = make([]*Item, len(keys))
+	for i, key := range keys {
+		observe := c.metric.Observe()
+		if values[i] == nil {
+			observe(key, MetricTypeGetRedisMiss, nil)
+			continue
+		}
+
+		its[i], err = c.decode(key, values[i], newObj())
+		if err != nil {
+			if !errors.Is(err, ErrDecrypt) {
+				return
+			}
+			err = nil
+			observe(key, MetricTypeGetRedisMiss, nil)
+			continue
+		}
+		observe(key, c.hitMetric(its[i]), nil)
 	}
-	it.Size = len(body)
 	return
 }
 
-func (c *redisCache) set(key string, obj interface{}, ttl time.Duration) (it *Item, err error) {
-	// redis set
-	defer c.metric.Observe()(key, MetricTypeSetRedis, &err)
+// storeMGet read values of keys from store, slot by slot in cluster mode.
+func (c *redisCache) storeMGet(ctx context.Context, keys []string) ([][]byte, error) {
+	if !c.cluster {
+		return c.store.MGet(ctx, keys)
+	}
 
-	it = newItem(obj, ttl)
-	redisTTL := 0
-	if ttl > 0 {
-		redisTTL = int(ttl/time.Second) * c.redisTTLFactor
+	values := make([][]byte, len(keys))
+	for _, group := range groupBySlot(keys) {
+		slotValues, err := c.store.MGet(ctx, keysAt(keys, group))
+		if err != nil {
+			return nil, err
+		}
+		for i, idx := range group {
+			values[idx] = slotValues[i]
+		}
 	}
+	return values, nil
+}
 
-	bs, err := marshal(it)
+// decode an item read from redis under key, obj is used to decode the object into, the object is not decoded if obj is nil.
+// an object which can't be decrypted is reported to onError, and ErrDecrypt returned.
+func (c *redisCache) decode(key string, body []byte, obj interface{}) (*Item, error) {
+	it, raw, err := decodeItem(body, obj, c.codecs, c.compressors, c.keys, []byte(key))
 	if err != nil {
+		if errors.Is(err, ErrDecrypt) {
+			c.onError(errors.WithStack(err))
+		}
+		return nil, err
+	}
+	it.setSize(raw)
+	return it, nil
+}
+
+// encode marshal it to be written to redis under key, and set its Size accordingly. must be called before it is shared.
+func (c *redisCache) encode(key string, it *Item) ([]byte, error) {
+	bs, raw, compressed, err := encodeItem(it, c.codec, c.compressor, c.compressThreshold, c.keys, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if compressed > 0 {
+		c.metric.Size(key, MetricTypeRawSize, raw)
+		c.metric.Size(key, MetricTypeCompressedSize, compressed)
+	}
+	// the size of the object in memory is closer to its raw encoding than to the compressed one
+	it.setSize(raw)
+	return bs, nil
+}
+
+func (c *redisCache) hitMetric(it *Item) string {
+	switch {
+	case it.Expired():
+		return MetricTypeGetRedisExpired
+	case it.NotFound:
+		return MetricTypeGetRedisNotFound
+	default:
+		return MetricTypeGetRedisHit
+	}
+}
+
+// set write body, the encoding of it, to redis. it lives redisTTLFactor times longer in redis than its remaining ttl.
+func (c *redisCache) set(ctx context.Context, key string, it *Item, body []byte) (err error) {
+	// redis set
+	defer c.metric.Observe()(key, MetricTypeSetRedis, &err)
+
+	return c.store.Set(ctx, key, body, c.redisTTL(key, it.ttl()))
+}
+
+// mset write items to redis at once, or slot by slot in cluster mode. items and their encoding bodies are keyed by redis key.
+func (c *redisCache) mset(ctx context.Context, items map[string]*Item, bodies map[string][]byte) (err error) {
+	if len(items) == 0 {
 		return
 	}
 
-	err = c.setString(key, string(bs), redisTTL)
+	observe := c.metric.Observe()
+	ttls := make(map[string]time.Duration, len(items))
+	for key, it := range items {
+		ttls[key] = c.redisTTL(key, it.ttl())
+	}
+
+	if !c.cluster {
+		err = c.storeMSet(ctx, bodies, ttls)
+	} else {
+		keys := make([]string, 0, len(bodies))
+		for key := range bodies {
+			keys = append(keys, key)
+		}
+		for _, group := range groupBySlot(keys) {
+			slotBodies := make(map[string][]byte, len(group))
+			for _, idx := range group {
+				slotBodies[keys[idx]] = bodies[keys[idx]]
+			}
+			if err = c.storeMSet(ctx, slotBodies, ttls); err != nil {
+				break
+			}
+		}
+	}
 	if err != nil {
 		return
 	}
+
+	for key := range items {
+		observe(key, MetricTypeSetRedis, nil)
+	}
 	return
 }
 
-func (c *redisCache) delete(key string) (err error) {
+// storeMSet write bodies to store at once if it is a MultiSetter, otherwise one by one.
+func (c *redisCache) storeMSet(ctx context.Context, bodies map[string][]byte, ttls map[string]time.Duration) error {
+	if s, ok := c.store.(MultiSetter); ok {
+		return s.MSet(ctx, bodies, ttls)
+	}
+
+	for key, body := range bodies {
+		if err := c.store.Set(ctx, key, body, ttls[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisCache) delete(ctx context.Context, key string) (err error) {
 	// redis del
 	defer c.metric.Observe()(key, MetricTypeDeleteRedis, &err)
 
-	conn := c.getConn()
-	defer conn.Close()
+	return c.store.Delete(ctx, key)
+}
 
-	_, err = conn.Do("DEL", key)
-	return
+// deleteMulti delete keys in batches, keys of a batch are in the same slot in cluster mode.
+func (c *redisCache) deleteMulti(ctx context.Context, keys []string) (err error) {
+	if c.cluster {
+		for _, group := range groupBySlot(keys) {
+			if err = c.deleteBatches(ctx, keysAt(keys, group)); err != nil {
+				return
+			}
+		}
+		return
+	}
+	return c.deleteBatches(ctx, keys)
 }
 
-func (c *redisCache) setString(key, value string, ttl int) (err error) {
-	conn := c.getConn()
-	defer conn.Close()
+// deleteBatches delete keys batch by batch.
+func (c *redisCache) deleteBatches(ctx context.Context, keys []string) (err error) {
+	for start := 0; start < len(keys); start += batchSize {
+		batch := keys[start:min(start+batchSize, len(keys))]
 
-	if ttl == 0 {
-		_, err = conn.Do("SET", key, value)
-	} else {
-		_, err = conn.Do("SETEX", key, ttl, value)
+		observe := c.metric.Observe()
+		if err = c.store.Delete(ctx, batch...); err != nil {
+			return
+		}
+		for _, key := range batch {
+			observe(key, MetricTypeDeleteRedis, nil)
+		}
 	}
 	return
 }
 
-func (c *redisCache) getString(key string) (value string, err error) {
-	conn := c.getConn()
-	defer conn.Close()
+// scan iterate over keys matching pattern, fn is called with each batch of keys found.
+func (c *redisCache) scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	s, ok := c.store.(Scanner)
+	if !ok {
+		return errors.WithStack(ErrNotSupported)
+	}
+	return s.Scan(ctx, pattern, fn)
+}
+
+// tag add key to the sets of tagKeys.
+func (c *redisCache) tag(ctx context.Context, key string, tagKeys []string, ttl time.Duration) (err error) {
+	t, ok := c.store.(Tagger)
+	if !ok {
+		return errors.WithStack(ErrNotSupported)
+	}
 
-	value, err = redis.String(conn.Do("GET", key))
+	redisTTL := c.redisTTL(key, ttl)
+	for _, tagKey := range tagKeys {
+		if err = t.Tag(ctx, tagKey, key, redisTTL); err != nil {
+			return
+		}
+	}
 	return
 }
+
+// untag remove and returns all members of tagKey, keys added concurrently are kept.
+func (c *redisCache) untag(ctx context.Context, tagKey string) ([]string, error) {
+	t, ok := c.store.(Tagger)
+	if !ok {
+		return nil, errors.WithStack(ErrNotSupported)
+	}
+	return t.Untag(ctx, tagKey)
+}
+
+// touch set expireAt of the item of key in place and its redis ttl, negative to keep the current ttl. returns false if not found.
+// stores of other packages are touched with Get then Set, keeping the current ttl requires an Expirer.
+func (c *redisCache) touch(ctx context.Context, key string, expireAt int64, ttl time.Duration) (bool, error) {
+	if t, ok := c.store.(toucher); ok {
+		return t.touch(ctx, key, expireAt, ttl)
+	}
+
+	body, err := c.store.Get(ctx, key)
+	if err != nil || body == nil {
+		return false, err
+	}
+	if ttl < 0 {
+		if ttl, err = c.pttl(ctx, key); err != nil || ttl == 0 {
+			return false, err
+		}
+		// no expiration
+		ttl = max(ttl, 0)
+	}
+
+	if body, err = touchEnvelope(body, expireAt); err != nil {
+		return false, err
+	}
+	return true, c.store.Set(ctx, key, body, ttl)
+}
+
+// pttl returns the remaining ttl of key, -1 if it has no expiration, 0 if it does not exist.
+func (c *redisCache) pttl(ctx context.Context, key string) (time.Duration, error) {
+	e, ok := c.store.(Expirer)
+	if !ok {
+		return 0, errors.WithStack(ErrNotSupported)
+	}
+	return e.TTL(ctx, key)
+}
+
+// lock acquire a lease on key for ttl if nobody holds it, token identifies the owner to unlock.
+func (c *redisCache) lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	l, ok := c.store.(Locker)
+	if !ok {
+		return false, errors.WithStack(ErrNotSupported)
+	}
+	return l.Lock(ctx, key, token, ttl)
+}
+
+// unlock release the lease on key if still owned by token.
+func (c *redisCache) unlock(ctx context.Context, key, token string) error {
+	l, ok := c.store.(Locker)
+	if !ok {
+		return errors.WithStack(ErrNotSupported)
+	}
+	return l.Unlock(ctx, key, token)
+}
+
+// redisTTL returns the ttl in redis of key for a mem ttl. 0 for no expiration.
+func (c *redisCache) redisTTL(key string, ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+
+	factor := c.redisTTLFactor
+	if f, ok := c.redisTTLFactors[c.metric.objectType(key)]; ok {
+		factor = f
+	}
+	return ttl.Truncate(time.Millisecond) * time.Duration(factor)
+}
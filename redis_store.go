@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// tagLua add ARGV[1] to the set KEYS[1] and make sure the set lives at least ARGV[2] milliseconds, 0 for no expiration.
+// returns ARGV[3] random members of the set to be pruned if their key no longer exists, which can't be checked here in cluster mode.
+const tagLua = `
+local existed = redis.call('EXISTS', KEYS[1])
+redis.call('SADD', KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call('PERSIST', KEYS[1])
+else
+	local cur = redis.call('PTTL', KEYS[1])
+	if existed == 0 or (cur >= 0 and cur < ttl) then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+end
+return redis.call('SRANDMEMBER', KEYS[1], ARGV[3])
+`
+
+// unlockLua delete KEYS[1] only if its value is still ARGV[1], a lease taken over by another owner after expiry is kept.
+const unlockLua = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+// touchLua set expire_at of the item envelope of KEYS[1] to ARGV[1], and its ttl to ARGV[2] milliseconds,
+// 0 for no expiration, -1 to keep the current ttl. returns 0 if KEYS[1] does not exist. see touchEnvelope.
+const touchLua = `
+local body = redis.call('GET', KEYS[1])
+if not body then
+	return 0
+end
+local n
+body, n = string.gsub(body, '^{"expire_at":%-?%d+', '{"expire_at":' .. ARGV[1], 1)
+if n == 0 then
+	-- envelopes written by older versions have expire_at after the object, the last match is the envelope's one
+	local s, e
+	local i = 1
+	while true do
+		local a, b = string.find(body, '"expire_at":%-?%d+', i)
+		if not a then
+			break
+		end
+		s, e, i = a, b, b + 1
+	end
+	if not s then
+		return redis.error_reply('expire_at not found in ' .. KEYS[1])
+	end
+	body = string.sub(body, 1, s - 1) .. '"expire_at":' .. ARGV[1] .. string.sub(body, e + 1)
+end
+local ttl = tonumber(ARGV[2])
+if ttl < 0 then
+	ttl = redis.call('PTTL', KEYS[1])
+end
+if ttl > 0 then
+	redis.call('SET', KEYS[1], body, 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], body)
+end
+return 1
+`
+
+var (
+	tagScript    = redis.NewScript(1, tagLua)
+	unlockScript = redis.NewScript(1, unlockLua)
+	touchScript  = redis.NewScript(1, touchLua)
+)
+
+// redisStore is the RemoteStore on redis with redigo.
+type redisStore struct {
+	// func to get redis conn from pool
+	getConn func() redis.Conn
+}
+
+// NewRedisStore create a RemoteStore on redis, getConn retrieves a redigo connection, typically from a pool.
+func NewRedisStore(getConn func() redis.Conn) RemoteStore {
+	return &redisStore{getConn: getConn}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	value, err := redis.Bytes(conn.Do("GET", key))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *redisStore) MGet(ctx context.Context, keys []string) ([][]byte, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	values, err := redis.ByteSlices(conn.Do("MGET", redis.Args{}.AddFlat(keys)...))
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	if ttl == 0 {
+		_, err = conn.Do("SET", key, value)
+	} else {
+		_, err = conn.Do("SET", key, value, "PX", ttl.Milliseconds())
+	}
+	return
+}
+
+// MSet write values in a single pipeline.
+func (s *redisStore) MSet(ctx context.Context, values map[string][]byte, ttls map[string]time.Duration) (err error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	for key, value := range values {
+		if ttl := ttls[key]; ttl == 0 {
+			err = conn.Send("SET", key, value)
+		} else {
+			err = conn.Send("SET", key, value, "PX", ttl.Milliseconds())
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if err = conn.Flush(); err != nil {
+		return
+	}
+	for range values {
+		if _, err = conn.Receive(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) (err error) {
+	if len(keys) == 0 {
+		return
+	}
+
+	conn := s.getConn()
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", redis.Args{}.AddFlat(keys)...)
+	return
+}
+
+func (s *redisStore) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	conn := s.getConn()
+	defer conn.Close()
+
+	cursor := 0
+	for {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", batchSize))
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		if _, err = redis.Scan(values, &cursor, &keys); err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *redisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	ms, err := redis.Int64(conn.Do("PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case ms == -2:
+		return 0, nil
+	case ms < 0:
+		return -1, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (s *redisStore) touch(ctx context.Context, key string, expireAt int64, ttl time.Duration) (bool, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	ms := int64(-1)
+	if ttl >= 0 {
+		ms = ttl.Milliseconds()
+	}
+	n, err := redis.Int(touchScript.Do(conn, key, expireAt, ms))
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *redisStore) Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("SET", key, token, "NX", "PX", ttl.Milliseconds()))
+	if err != nil {
+		if err == redis.ErrNil {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *redisStore) Unlock(ctx context.Context, key, token string) error {
+	conn := s.getConn()
+	defer conn.Close()
+
+	_, err := unlockScript.Do(conn, key, token)
+	return err
+}
+
+func (s *redisStore) Tag(ctx context.Context, tagKey, member string, ttl time.Duration) error {
+	conn := s.getConn()
+	defer conn.Close()
+
+	sample, err := redis.Strings(tagScript.Do(conn, tagKey, member, ttl.Milliseconds(), tagPruneSample))
+	if err != nil {
+		return err
+	}
+
+	for _, m := range sample {
+		if err = conn.Send("EXISTS", m); err != nil {
+			return err
+		}
+	}
+	if err = conn.Flush(); err != nil {
+		return err
+	}
+	var gone []string
+	for _, m := range sample {
+		exists, err := redis.Bool(conn.Receive())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			gone = append(gone, m)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	_, err = conn.Do("SREM", redis.Args{}.Add(tagKey).AddFlat(gone)...)
+	return err
+}
+
+func (s *redisStore) Untag(ctx context.Context, tagKey string) (members []string, err error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	members, err = redis.Strings(conn.Do("SMEMBERS", tagKey))
+	if err != nil {
+		return
+	}
+
+	for start := 0; start < len(members); start += batchSize {
+		batch := members[start:min(start+batchSize, len(members))]
+		if _, err = conn.Do("SREM", redis.Args{}.Add(tagKey).AddFlat(batch)...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Publish msgs in a single pipeline.
+func (s *redisStore) Publish(ctx context.Context, channel string, msgs ...string) error {
+	conn := s.getConn()
+	defer conn.Close()
+
+	for _, msg := range msgs {
+		if err := conn.Send("PUBLISH", channel, msg); err != nil {
+			return err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for range msgs {
+		if _, err := conn.Receive(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redisStore) Subscribe(ctx context.Context, channel string, onMessage func(msg string)) (func() error, error) {
+	conn := s.getConn()
+	psc := &redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(channel); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// subscribed once confirmed
+	for {
+		v := psc.Receive()
+		if err, ok := v.(error); ok {
+			conn.Close()
+			return nil, err
+		}
+		if sub, ok := v.(redis.Subscription); ok && sub.Kind == "subscribe" {
+			break
+		}
+	}
+
+	return func() error {
+		// unsubscribe once ctx is done, Receive returns the unsubscription
+		unsubscribed := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			defer close(unsubscribed)
+			psc.Unsubscribe()
+		})
+		defer func() {
+			// the conn is closed once Unsubscribe has returned, if running
+			if !stop() {
+				<-unsubscribed
+			}
+			conn.Close()
+		}()
+
+		for {
+			switch v := psc.Receive().(type) {
+			case redis.Message:
+				onMessage(string(v.Data))
+			case redis.Subscription:
+				if v.Kind == "unsubscribe" && v.Count == 0 {
+					return nil
+				}
+			case error:
+				if ctx.Err() != nil {
+					return nil
+				}
+				// the conn is not usable anymore, subscribe again with a new conn
+				return v
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RemoteStore is the shared tier of the cache, items are written to it as envelopes and instances are notified of changes
+// through its pub-sub. redis with redigo is used by default, see NewRedisStore, NewInProcessStore for a store within the process.
+//
+// a store may implement optional capabilities, detected by type assertion: MultiSetter, Scanner, Expirer, Locker and Tagger.
+// features relying on a capability the store lacks return ErrNotSupported, unless documented otherwise.
+// all of them are implemented by the stores of this package.
+type RemoteStore interface {
+	// Get returns the value of key, nil if not found.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// MGet returns the values of keys in the same order as keys, nil for a key not found.
+	MGet(ctx context.Context, keys []string) ([][]byte, error)
+
+	// Set write value of key, which lives ttl, 0 for no expiration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete keys, keys not found are ignored.
+	Delete(ctx context.Context, keys ...string) error
+
+	// Publish msgs to channel, in order.
+	Publish(ctx context.Context, channel string, msgs ...string) error
+
+	// Subscribe to channel, returns once subscribed. wait calls onMessage with each message published to channel,
+	// until ctx is done and nil is returned, or the subscription is lost and its error is returned, then the cache subscribes again.
+	Subscribe(ctx context.Context, channel string, onMessage func(msg string)) (wait func() error, err error)
+}
+
+// MultiSetter writes several values at once, GetObjects writes them one by one with Set otherwise.
+type MultiSetter interface {
+	// MSet write values keyed by key, each one lives the ttl of its key in ttls, 0 for no expiration.
+	MSet(ctx context.Context, values map[string][]byte, ttls map[string]time.Duration) error
+}
+
+// Scanner iterates over keys, required by DeleteObjectType.
+type Scanner interface {
+	// Scan call fn with batches of keys matching pattern, a redis glob-style pattern.
+	Scan(ctx context.Context, pattern string, fn func(keys []string) error) error
+}
+
+// Expirer reports the ttl of keys, for RedisTTL of Inspect. it is also required to expire an object in place with Testing.
+type Expirer interface {
+	// TTL returns the remaining ttl of key, -1 if it has no expiration, 0 if not found.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// Locker holds leases, required by LoadLock.
+type Locker interface {
+	// Lock set key to token for ttl if key does not exist, returns false if it exists.
+	Lock(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+
+	// Unlock delete key only if its value is still token.
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// Tagger maintains sets of keys, required by Tags and DeleteByTag.
+type Tagger interface {
+	// Tag add member to the set tagKey, which lives at least ttl, 0 for no expiration.
+	// a few random members whose key no longer exists should be removed, so that the set does not grow with expired keys.
+	Tag(ctx context.Context, tagKey, member string, ttl time.Duration) error
+
+	// Untag remove and returns all members of the set tagKey, members added concurrently are kept.
+	Untag(ctx context.Context, tagKey string) ([]string, error)
+}
+
+// toucher updates the expiration of an envelope in place, atomically. stores of other packages are touched with Get and Set,
+// a write between them is lost.
+type toucher interface {
+	// touch set expire_at of the envelope of key to expireAt, see touchEnvelope, and its ttl, 0 for no expiration,
+	// negative to keep the current ttl. returns false if not found.
+	touch(ctx context.Context, key string, expireAt int64, ttl time.Duration) (bool, error)
+}
+
+var (
+	envelopeExpireAt = regexp.MustCompile(`^\{"expire_at":-?\d+`)
+	legacyExpireAt   = regexp.MustCompile(`"expire_at":-?\d+`)
+)
+
+// touchEnvelope returns value, an item envelope, with its expire_at set to expireAt, like touchLua.
+func touchEnvelope(value []byte, expireAt int64) ([]byte, error) {
+	field := `"expire_at":` + strconv.FormatInt(expireAt, 10)
+	if loc := envelopeExpireAt.FindIndex(value); loc != nil {
+		return append([]byte("{"+field), value[loc[1]:]...), nil
+	}
+
+	// envelopes written by older versions have expire_at after the object, the last match is the envelope's one
+	locs := legacyExpireAt.FindAllIndex(value, -1)
+	if len(locs) == 0 {
+		return nil, errors.New("expire_at not found")
+	}
+	loc := locs[len(locs)-1]
+	touched := make([]byte, 0, len(value)+len(field))
+	touched = append(touched, value[:loc[0]]...)
+	touched = append(touched, field...)
+	return append(touched, value[loc[1]:]...), nil
+}
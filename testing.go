@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	syncMarker = ":__sync__:"
+
+	// interval to publish the sync marker again until received
+	syncRepublishInterval = 100 * time.Millisecond
+
+	// max time NewForTesting waits for the cache instance to subscribe
+	subscribeTimeout = 5 * time.Second
+
+	// interval to check whether loads are still in flight
+	waitLoadsInterval = time.Millisecond
+)
+
+// MetricRecord is a metric captured by Testing.
+type MetricRecord struct {
+	Key         string
+	ObjectType  string
+	MetricType  string
+	Count       int
+	ElapsedTime time.Duration
+}
+
+// Testing allows to inspect and manipulate the state of a cache instance, for test purpose only.
+type Testing struct {
+	c *cache
+
+	mu      sync.Mutex
+	metrics []MetricRecord
+
+	// pending sync markers, marker -> chan closed once the marker is received
+	syncSeq atomic.Int64
+	syncs   sync.Map
+}
+
+// NewForTesting create a cache like New, with a Testing to inspect and manipulate its state.
+// all metrics are captured by Testing, OnMetric is still called if provided.
+// it returns once the cache instance has subscribed to the delete channel, so that no message published afterwards is missed.
+func NewForTesting(options ...Option) (*Testing, Cache) {
+	t := &Testing{}
+	options = append(options[:len(options):len(options)], func(o *Options) {
+		onMetric := o.Metric.onMetric
+		o.Metric.onMetric = func(key, objectType string, metricType string, count int, elapsedTime time.Duration) {
+			t.record(MetricRecord{
+				Key:         key,
+				ObjectType:  objectType,
+				MetricType:  metricType,
+				Count:       count,
+				ElapsedTime: elapsedTime,
+			})
+			if onMetric != nil {
+				onMetric(key, objectType, metricType, count, elapsedTime)
+			}
+		}
+		o.onMessage = t.onMessage
+	})
+	t.c = newCache(options...)
+
+	select {
+	case <-t.c.subscribed:
+	case <-time.After(subscribeTimeout):
+	}
+	return t, t.c
+}
+
+// DeleteFromMem allows to delete key from mem, for test purpose
+func (t *Testing) DeleteFromMem(key string) {
+	t.c.mem.delete(t.c.namespacedKey(key))
+}
+
+// DeleteFromRedis allows to delete key from redis, for test purpose
+func (t *Testing) DeleteFromRedis(key string) error {
+	return t.c.rds.delete(context.Background(), t.c.namespacedKey(key))
+}
+
+// MemItem returns the item of key in mem without updating any metric, nil if not found.
+func (t *Testing) MemItem(key string) *Item {
+	return t.c.mem.peek(t.c.namespacedKey(key))
+}
+
+// RedisItem returns the item of key in redis without updating any metric, nil if not found.
+// obj is used to unmarshal the object into, like in GetObject.
+func (t *Testing) RedisItem(key string, obj any) (*Item, error) {
+	it, err := t.c.rds.peek(context.Background(), t.c.namespacedKey(key), obj)
+	return it, errors.WithStack(err)
+}
+
+// Expire force the item of key to be expired in both mem and redis, while keeping it cached.
+func (t *Testing) Expire(key string) error {
+	namespacedKey := t.c.namespacedKey(key)
+	expireAt := time.Now().Add(-time.Millisecond).UnixMilli()
+
+	t.c.mem.touch(namespacedKey, expireAt)
+
+	// keep the remaining redis ttl
+	_, err := t.c.rds.touch(context.Background(), namespacedKey, expireAt, -1)
+	return errors.WithStack(err)
+}
+
+// SyncPubSub waits until all messages published to the delete channel before the call have been applied by this cache instance.
+// the marker is published again periodically, in case the cache instance has not subscribed yet.
+func (t *Testing) SyncPubSub(ctx context.Context) error {
+	marker := t.c.options.Namespace + syncMarker + strconv.FormatInt(time.Now().UnixNano(), 10) + "_" + strconv.FormatInt(t.syncSeq.Add(1), 10)
+	done := make(chan struct{})
+	t.syncs.Store(marker, done)
+	defer t.syncs.Delete(marker)
+
+	ticker := time.NewTicker(syncRepublishInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.c.notifyDelete(ctx, marker); err != nil {
+			return errors.WithStack(err)
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+// WaitLoads waits until no load is in flight, including async loads and loads which outlived the ctx of their call.
+func (t *Testing) WaitLoads(ctx context.Context) error {
+	ticker := time.NewTicker(waitLoadsInterval)
+	defer ticker.Stop()
+
+	for t.c.inflight.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Metrics returns all metrics captured so far.
+func (t *Testing) Metrics() []MetricRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]MetricRecord(nil), t.metrics...)
+}
+
+// ResetMetrics discard all metrics captured so far.
+func (t *Testing) ResetMetrics() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.metrics = nil
+}
+
+func (t *Testing) record(m MetricRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.metrics = append(t.metrics, m)
+}
+
+// onMessage consumes sync markers, markers of other instances sharing the namespace are consumed as well.
+func (t *Testing) onMessage(msg string) bool {
+	if !strings.HasPrefix(msg, t.c.options.Namespace+syncMarker) {
+		return false
+	}
+	// a republished marker may be received several times
+	if done, ok := t.syncs.LoadAndDelete(msg); ok {
+		close(done.(chan struct{}))
+	}
+	return true
+}
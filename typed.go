@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Typed is a type-safe facade of Cache for objects of type T, objects are returned directly instead of being copied into a caller-supplied pointer.
+// T is usually a pointer to struct like *TestStruct, it can't be an interface since data from redis is unmarshalled into a new T.
+type Typed[T any] struct {
+	c Cache
+
+	// type of T
+	t reflect.Type
+}
+
+// NewTyped wrap c for objects of type T, it panics if T is an interface type.
+func NewTyped[T any](c Cache) *Typed[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("Typed does not support interface type %v", t))
+	}
+	return &Typed[T]{c: c, t: t}
+}
+
+// Get returns the object of key, loader function f() will be called in case cache all miss.
+func (t *Typed[T]) Get(ctx context.Context, key string, ttl time.Duration, f func(ctx context.Context) (T, error), opts ...Option) (T, error) {
+	// always get into a pointer to struct rather than a pointer to pointer, which can't be deepcopied into.
+	obj := newObject(t.t)
+	err := t.c.GetObjectCtx(ctx, key, obj, ttl, func(ctx context.Context) (any, error) {
+		return f(ctx)
+	}, opts...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if t.t.Kind() == reflect.Ptr {
+		return obj.(T), nil
+	}
+	return reflect.ValueOf(obj).Elem().Interface().(T), nil
+}
+
+// GetMany returns the objects found for keys, loader function f() will be called once with all keys missing from cache.
+func (t *Typed[T]) GetMany(ctx context.Context, keys []string, ttl time.Duration, f func(ctx context.Context, missingKeys []string) (map[string]T, error), opts ...Option) (map[string]T, error) {
+	vs := make(map[string]T, len(keys))
+	err := t.c.GetObjectsCtx(ctx, keys, vs, ttl, func(ctx context.Context, missingKeys []string) (map[string]any, error) {
+		loaded, err := f(ctx, missingKeys)
+		if err != nil {
+			return nil, err
+		}
+
+		objs := make(map[string]any, len(loaded))
+		for key, v := range loaded {
+			objs[key] = v
+		}
+		return objs, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return vs, nil
+}
+
+// Set write v to cache with given ttl.
+func (t *Typed[T]) Set(ctx context.Context, key string, v T, ttl time.Duration, opts ...Option) error {
+	return t.c.Set(ctx, key, v, ttl, opts...)
+}
+
+// Delete notify all cache instances to delete cache key.
+func (t *Typed[T]) Delete(ctx context.Context, key string) error {
+	return t.c.Delete(ctx, key)
+}